@@ -91,7 +91,8 @@ func initLogging(level string) {
 		TimeFormat: time.TimeOnly,
 	}
 
-	logger := slog.New(tint.NewHandler(os.Stdout, loggerOpts))
+	// Logs go to stderr, stdout is reserved for command output and MCP stdio transport.
+	logger := slog.New(tint.NewHandler(os.Stderr, loggerOpts))
 
 	// Any call to log.* will be redirected to slog.Error.
 	// Because of that, we need to agree to use `log` package only for errors.
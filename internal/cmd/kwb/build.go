@@ -3,44 +3,106 @@ package kwb
 import (
 	"fmt"
 	"log/slog"
+	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/hasansino/go42x/internal/cmdutil"
+	"github.com/hasansino/go42x/internal/version"
 	"github.com/hasansino/go42x/pkg/kwb"
 )
 
 func newBuildCommand(f *cmdutil.Factory, settings *kwb.Settings) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "build",
-		Short: "Build or rebuild the knowledge base index",
-		Long:  `Build or rebuild the knowledge base index`,
+		Short: "Build or update the knowledge base index",
+		Long: `Build or update the knowledge base index.
+Only files added or changed since the previous build are re-indexed,
+use --full to discard the existing index and rebuild it from scratch.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runBuildCommand(f, settings)
 		},
 	}
 
-	cmd.Flags().StringVar(&settings.RootPath, "root", ".", "root directory to index")
-	cmd.Flags().IntVar(&settings.MaxFileSize, "max-file-size", 5*1024*1024, "maximum file size to index in bytes")
-	cmd.Flags().IntVar(&settings.BatchSize, "batch-size", 100, "number of documents to index in a batch")
-	cmd.Flags().StringVar(&settings.IndexType, "index-type", "scorch", "index type: scorch or upsidedown")
-	cmd.Flags().StringSliceVar(&settings.ExcludeDirs, "exclude-dir", nil, "additional directories to exclude")
-	cmd.Flags().StringSliceVar(&settings.ExtraExtensions, "include-ext", nil, "additional file extensions to index")
+	bindIndexFlags(cmd.Flags(), settings)
+	cmd.Flags().BoolVar(&settings.FullRebuild, "full", false, "discard existing index and rebuild from scratch")
 
 	return cmd
 }
 
+// bindIndexFlags binds flags which control what gets indexed.
+// Shared by commands which write to the index.
+func bindIndexFlags(flags *pflag.FlagSet, settings *kwb.Settings) {
+	flags.StringArrayVar(&settings.Roots, "root", []string{"."},
+		"root directory to index, repeat to index several repos, name them with alias=path (e.g. api=../api)")
+	flags.IntVar(&settings.MaxFileSize, "max-file-size", 5*1024*1024, "maximum file size to index in bytes")
+	flags.IntVar(&settings.BatchSize, "batch-size", 100, "number of documents to index in a batch")
+	flags.StringVar(&settings.IndexType, "index-type", "scorch", "index type: scorch or upsidedown")
+	flags.StringVar(&settings.Analyzer, "analyzer", kwb.AnalyzerCode, "text analyzer: code or standard")
+	flags.IntVar(&settings.ChunkLines, "chunk-lines", 80, "split files longer than this into chunks (0 to disable)")
+	flags.IntVar(&settings.ChunkOverlap, "chunk-overlap", 10, "number of lines shared by consecutive chunks")
+	flags.StringSliceVar(&settings.ExcludeDirs, "exclude-dir", nil,
+		"additional directories or gitignore-style directory patterns (e.g. internal/gen) to exclude")
+	flags.BoolVar(&settings.NoGitignore, "no-gitignore", false,
+		"do not honour .gitignore files, .kwbignore is always honoured")
+	flags.StringSliceVar(&settings.ExtraExtensions, "include-ext", nil, "additional file extensions to index")
+	flags.StringSliceVar(&settings.DenyFiles, "deny-file", nil,
+		"additional file name patterns (e.g. *.secret) which are never indexed")
+	flags.BoolVar(&settings.IndexDeps, "deps", false,
+		"also index sources of modules required by go.mod, found in module cache (nothing is downloaded)")
+	flags.IntVar(&settings.HistoryCommits, "history", 0,
+		"also index the last N commits of each root (default 100 when given without value)")
+	flags.Lookup("history").NoOptDefVal = "100"
+	bindEmbedderFlags(flags, settings)
+}
+
+// recordedIndexFlags are flags whose values are recorded in the index manifest.
+var recordedIndexFlags = []string{
+	"root", "max-file-size", "index-type", "exclude-dir", "no-gitignore",
+	"include-ext", "deny-file", "deps", "history",
+}
+
+// indexedRoots returns roots given by flags, or nil if none of recorded flags were given,
+// so commands which keep existing index up to date use the roots and options it was built with.
+func indexedRoots(flags *pflag.FlagSet, settings *kwb.Settings) ([]kwb.Root, error) {
+	for _, name := range recordedIndexFlags {
+		if flags.Changed(name) {
+			return kwb.ParseRoots(settings.Roots)
+		}
+	}
+	return nil, nil
+}
+
+// bindEmbedderFlags binds flags which select embedder for semantic search,
+// search must use the same embedder as the index was built with.
+func bindEmbedderFlags(flags *pflag.FlagSet, settings *kwb.Settings) {
+	flags.StringVar(&settings.Embedder, "embedder", kwb.EmbedderHash,
+		"embedder for semantic search: hash, openai or none")
+	flags.StringVar(&settings.EmbeddingURL, "embedding-url", "",
+		"base url of OpenAI-compatible embeddings API, e.g. http://localhost:11434/v1")
+	flags.StringVar(&settings.EmbeddingModel, "embedding-model", "", "embedding model served by the API")
+	flags.StringVar(&settings.EmbeddingAPIKey, "embedding-api-key", os.Getenv("KWB_EMBEDDING_API_KEY"),
+		"api key of embeddings API (env: KWB_EMBEDDING_API_KEY)")
+}
+
 func runBuildCommand(f *cmdutil.Factory, settings *kwb.Settings) error {
+	roots, err := kwb.ParseRoots(settings.Roots)
+	if err != nil {
+		return fmt.Errorf("invalid roots: %w", err)
+	}
+
 	service, err := kwb.NewService(
 		settings,
 		kwb.WithLogger(slog.Default().With("component", "kwb-service")),
+		kwb.WithVersion(version.GetVersion()),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create service: %w", err)
 	}
 	defer service.Close() // nolint:errcheck
 
-	if err := service.BuildIndex(f.Context(), settings.RootPath); err != nil {
+	if err := service.BuildIndex(f.Context(), roots); err != nil {
 		return fmt.Errorf("failed to build index: %w", err)
 	}
 
@@ -22,9 +22,11 @@ func NewKnowledgeBaseCommand(f *cmdutil.Factory) *cobra.Command {
 	cmd.PersistentFlags().StringVar(&settings.IndexPath, "index", ".agentenv/kwb/index", "path to the index")
 
 	cmd.AddCommand(newBuildCommand(f, settings))
+	cmd.AddCommand(newListCommand(f, settings))
 	cmd.AddCommand(newSearchCommand(f, settings))
 	cmd.AddCommand(newServeCommand(f, settings))
 	cmd.AddCommand(newStatsCommand(f, settings))
+	cmd.AddCommand(newWatchCommand(f, settings))
 
 	return cmd
 }
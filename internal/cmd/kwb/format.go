@@ -0,0 +1,225 @@
+package kwb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hasansino/go42x/pkg/kwb"
+)
+
+// Output formats of commands which print results.
+const (
+	formatText    = "text"
+	formatJSON    = "json"
+	formatJSONL   = "jsonl"
+	formatVimgrep = "vimgrep"
+)
+
+func validateFormat(format string, allowed ...string) error {
+	if !slices.Contains(allowed, format) {
+		return fmt.Errorf("invalid format: %s (must be one of: %s)", format, strings.Join(allowed, ", "))
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, v any, indent bool) error {
+	enc := json.NewEncoder(w)
+	if indent {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
+}
+
+func writeSearchResponse(w io.Writer, format string, response *kwb.SearchResponse, group, showScore bool) error {
+	switch format {
+	case formatJSON:
+		if group {
+			return writeJSON(w, struct {
+				Files  []kwb.FileResults `json:"files"`
+				Total  uint64            `json:"total"`
+				Offset int               `json:"offset"`
+				Facets []kwb.Facet       `json:"facets,omitempty"`
+			}{kwb.GroupByFile(response.Results), response.Total, response.Offset, response.Facets}, true)
+		}
+		return writeJSON(w, response, true)
+	case formatJSONL:
+		for _, result := range response.Results {
+			if err := writeJSON(w, result, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatVimgrep:
+		// File, its chunks and symbols may all match on the same line,
+		// quickfix list should have a single entry per line.
+		type location struct {
+			file string
+			line int
+		}
+		seen := make(map[location]bool, len(response.Results))
+		for _, result := range response.Results {
+			line, column := result.Line, result.Column
+			if line == 0 {
+				line, column = max(result.StartLine, 1), 1
+			}
+			loc := location{result.FileID(), line}
+			if seen[loc] {
+				continue
+			}
+			seen[loc] = true
+			text := result.LineText
+			if text == "" {
+				text = result.Signature
+			}
+			if _, err := fmt.Fprintf(w, "%s:%d:%d:%s\n", result.FileID(), line, column, text); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return writeSearchText(w, response, group, showScore)
+	}
+}
+
+func writeSearchText(w io.Writer, response *kwb.SearchResponse, group, showScore bool) error {
+	var b strings.Builder
+
+	if len(response.Results) == 0 {
+		b.WriteString("No results found\n")
+	} else {
+		fmt.Fprintf(&b, "Found %d results (showing %d-%d)\n\n",
+			response.Total, response.Offset+1, response.NextOffset())
+	}
+
+	if group {
+		for i, g := range kwb.GroupByFile(response.Results) {
+			fmt.Fprintf(&b, "%d. %s (%s)\n", i+1, g.Location(), g.Type)
+			for _, result := range g.Results {
+				writeSearchResultText(&b, "   - ", result, showScore)
+			}
+			b.WriteString("\n")
+		}
+	} else {
+		for i, result := range response.Results {
+			writeSearchResultText(&b, fmt.Sprintf("%d. ", response.Offset+i+1), result, showScore)
+			b.WriteString("\n")
+		}
+	}
+
+	for _, facet := range response.Facets {
+		fmt.Fprintf(&b, "Matching files by %s:\n", facet.Field)
+		for _, term := range facet.Terms {
+			fmt.Fprintf(&b, "  %-30s %d\n", term.Term, term.Count)
+		}
+		if facet.Other > 0 {
+			fmt.Fprintf(&b, "  %-30s %d\n", "(other)", facet.Other)
+		}
+		b.WriteString("\n")
+	}
+
+	if response.HasMore() {
+		fmt.Fprintf(&b, "More results available, use --offset %d\n", response.NextOffset())
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeSearchResultText(b *strings.Builder, prefix string, result kwb.SearchResult, showScore bool) {
+	indent := strings.Repeat(" ", len(prefix))
+
+	b.WriteString(prefix)
+	b.WriteString(result.Location())
+	fmt.Fprintf(b, " (%s", result.Type)
+	if showScore {
+		fmt.Fprintf(b, ", score: %.2f", result.Score)
+	}
+	b.WriteString(")\n")
+
+	if result.Signature != "" {
+		fmt.Fprintf(b, "%s%s\n", indent, result.Signature)
+	}
+	if result.Section != "" {
+		fmt.Fprintf(b, "%s%s (#%s)\n", indent, result.Section, result.Anchor)
+	}
+	if result.LineText != "" {
+		fmt.Fprintf(b, "%s%s\n", indent, strings.TrimSpace(result.LineText))
+	} else if result.Preview != "" {
+		fmt.Fprintf(b, "%s%s\n", indent, strings.Join(strings.Fields(result.Preview), " "))
+	}
+}
+
+func writeStats(w io.Writer, format string, stats map[string]interface{}) error {
+	switch format {
+	case formatJSON:
+		return writeJSON(w, stats, true)
+	case formatJSONL:
+		return writeJSON(w, stats, false)
+	default:
+		var b strings.Builder
+		for _, key := range slices.Sorted(maps.Keys(stats)) {
+			fmt.Fprintf(&b, "%-20s %s\n", key+":", formatStatValue(stats[key]))
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+}
+
+// formatStatValue renders nested values of stats on a single line.
+func formatStatValue(v any) string {
+	switch v := v.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return "-"
+		}
+		return v.Format(time.RFC3339)
+	case []string:
+		if len(v) == 0 {
+			return "-"
+		}
+		return strings.Join(v, ",")
+	case map[string]int:
+		parts := make([]string, 0, len(v))
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			parts = append(parts, fmt.Sprintf("%s=%d", key, v[key]))
+		}
+		return strings.Join(parts, ", ")
+	case map[string]interface{}:
+		parts := make([]string, 0, len(v))
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			parts = append(parts, fmt.Sprintf("%s=%s", key, formatStatValue(v[key])))
+		}
+		return strings.Join(parts, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func writeFileList(w io.Writer, format string, list *kwb.FileList) error {
+	switch format {
+	case formatJSON:
+		return writeJSON(w, list, true)
+	case formatJSONL:
+		for _, file := range list.Files {
+			if err := writeJSON(w, struct {
+				Path string `json:"path"`
+			}{file}, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		var b strings.Builder
+		for _, file := range list.Files {
+			b.WriteString(file)
+			b.WriteString("\n")
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+}
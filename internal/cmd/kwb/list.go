@@ -0,0 +1,73 @@
+package kwb
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hasansino/go42x/internal/cmdutil"
+	"github.com/hasansino/go42x/pkg/kwb"
+)
+
+func newListCommand(f *cmdutil.Factory, settings *kwb.Settings) *cobra.Command {
+	var (
+		opts   kwb.ListOptions
+		format string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List indexed files",
+		Long:  `List files stored in the knowledge base index`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runListCommand(f, cmd.OutOrStdout(), settings, opts, format)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Type, "type", "", "filter by document type: code, documentation, config, ...")
+	cmd.Flags().StringVar(&opts.Repo, "repo", "", "filter by repo, alias of an indexed root")
+	cmd.Flags().IntVar(&opts.Limit, "limit", 1000, "maximum number of files")
+	cmd.Flags().IntVar(&opts.Offset, "offset", 0, "number of files to skip")
+	cmd.Flags().StringVar(&opts.Cursor, "cursor", "", "cursor returned by previous page")
+	cmd.Flags().StringVar(&format, "format", formatText, "output format: text, json or jsonl")
+
+	return cmd
+}
+
+func runListCommand(
+	f *cmdutil.Factory,
+	w io.Writer,
+	settings *kwb.Settings,
+	opts kwb.ListOptions,
+	format string,
+) error {
+	if err := validateFormat(format, formatText, formatJSON, formatJSONL); err != nil {
+		return err
+	}
+
+	if !settings.IndexExists() {
+		return fmt.Errorf("index not found at %s, run 'kwb build' first", settings.IndexPath)
+	}
+
+	service, err := kwb.NewService(
+		settings,
+		kwb.WithLogger(slog.Default().With("component", "kwb-service")),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer service.Close() // nolint:errcheck
+
+	list, err := service.ListFiles(f.Context(), opts)
+	if err != nil {
+		return fmt.Errorf("failed to list files: %w", err)
+	}
+
+	if list.NextCursor != "" {
+		slog.Default().Info("More files available", slog.String("next_cursor", list.NextCursor))
+	}
+
+	return writeFileList(w, format, list)
+}
@@ -2,6 +2,7 @@ package kwb
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
 	"strings"
 	"time"
@@ -13,27 +14,65 @@ import (
 )
 
 func newSearchCommand(f *cmdutil.Factory, settings *kwb.Settings) *cobra.Command {
+	var (
+		opts   kwb.SearchOptions
+		format string
+	)
+
 	cmd := &cobra.Command{
 		Use:   "search <query>",
 		Short: "Search the knowledge base",
-		Long:  `Search the knowledge base using full-text search`,
-		Args:  cobra.MinimumNArgs(1),
+		Long: `Search the knowledge base using full-text search.
+
+Query may be scoped with field prefixes, values may be comma separated:
+  type:code          document type
+  path:pkg/kwb/*.go  path glob or directory prefix
+  ext:go,proto       file extension
+  sym:New*           symbol name
+  pkg:kwb            Go package name
+  repo:api           repo, alias of an indexed root
+Prefix with - to exclude matches, e.g. "retry type:code -path:vendor/**".`,
+		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			query := strings.Join(args, " ")
-			return runSearchCommand(f, settings, query)
+			return runSearchCommand(f, cmd.OutOrStdout(), settings, query, opts, format)
 		},
 	}
 
 	cmd.Flags().IntVar(&settings.SearchLimit, "limit", 10, "maximum number of results")
 	cmd.Flags().BoolVar(&settings.SearchShowScore, "show-score", false, "show relevance scores")
+	cmd.Flags().BoolVar(&settings.SearchGroup, "group", false, "group results per file")
 	cmd.Flags().DurationVar(&settings.SearchTimeout, "timeout", 5*time.Second, "search timeout duration")
 	cmd.Flags().IntVar(&settings.SearchFuzziness, "fuzzy", 0, "fuzzy search distance (0=exact, 1-2=fuzzy)")
 	cmd.Flags().StringVar(&settings.HighlightStyle, "highlight", "ansi", "highlight style: ansi or html")
+	cmd.Flags().StringSliceVar(&opts.Repos, "repo", nil, "filter by repo, alias of an indexed root")
+	cmd.Flags().StringSliceVar(&opts.Types, "type", nil, "filter by document type: code, documentation, config, ...")
+	cmd.Flags().StringSliceVar(&opts.Paths, "path", nil, "include only paths matching glob or directory prefix")
+	cmd.Flags().StringSliceVar(&opts.ExcludePaths, "exclude-path", nil,
+		"exclude paths matching glob or directory prefix")
+	cmd.Flags().StringSliceVar(&opts.Extensions, "ext", nil, "filter by file extension")
+	cmd.Flags().IntVar(&opts.Offset, "offset", 0, "number of results to skip")
+	cmd.Flags().StringVar(&format, "format", formatText, "output format: text, json, jsonl or vimgrep")
+	cmd.Flags().BoolVar(&opts.Facets, "facets", false, "show counts of matching files per type and directory")
+	cmd.Flags().StringVar(&opts.Sort, "sort", "score", "sort order: score, path or type, prefix with - for descending")
+	cmd.Flags().StringVar(&opts.Mode, "mode", kwb.SearchModeKeyword, "search mode: keyword, semantic or hybrid")
+	bindEmbedderFlags(cmd.Flags(), settings)
 
 	return cmd
 }
 
-func runSearchCommand(f *cmdutil.Factory, settings *kwb.Settings, query string) error {
+func runSearchCommand(
+	f *cmdutil.Factory,
+	w io.Writer,
+	settings *kwb.Settings,
+	query string,
+	opts kwb.SearchOptions,
+	format string,
+) error {
+	if err := validateFormat(format, formatText, formatJSON, formatJSONL, formatVimgrep); err != nil {
+		return err
+	}
+
 	if !settings.IndexExists() {
 		return fmt.Errorf("index not found at %s, run 'kwb build' first", settings.IndexPath)
 	}
@@ -47,39 +86,11 @@ func runSearchCommand(f *cmdutil.Factory, settings *kwb.Settings, query string)
 	}
 	defer service.Close() // nolint:errcheck
 
-	results, err := service.Search(f.Context(), query, settings.SearchLimit)
+	opts.Limit = settings.SearchLimit
+	response, err := service.Search(f.Context(), query, opts)
 	if err != nil {
 		return fmt.Errorf("search failed: %w", err)
 	}
 
-	if len(results) == 0 {
-		slog.Default().Info("No results found")
-		return nil
-	}
-
-	slog.Default().Info("Search completed", slog.Int("results", len(results)))
-
-	for i, result := range results {
-		slog.Default().Info("Search result",
-			slog.Int("index", i+1),
-			slog.String("path", result.Path),
-			slog.String("type", result.Type),
-			slog.Float64("score", result.Score),
-			slog.Bool("showScore", settings.SearchShowScore),
-		)
-		if result.Preview != "" {
-			// Clean up the preview
-			preview := strings.ReplaceAll(result.Preview, "\n", " ")
-			preview = strings.TrimSpace(preview)
-			if len(preview) > 100 {
-				preview = preview[:100] + "..."
-			}
-			slog.Default().Info("Result preview",
-				slog.Int("index", i+1),
-				slog.String("preview", preview),
-			)
-		}
-	}
-
-	return nil
+	return writeSearchResponse(w, format, response, settings.SearchGroup, settings.SearchShowScore)
 }
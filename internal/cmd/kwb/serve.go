@@ -3,28 +3,48 @@ package kwb
 import (
 	"fmt"
 	"log/slog"
+	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/hasansino/go42x/internal/cmdutil"
+	"github.com/hasansino/go42x/internal/version"
 	"github.com/hasansino/go42x/pkg/kwb"
 )
 
 func newServeCommand(f *cmdutil.Factory, settings *kwb.Settings) *cobra.Command {
+	var watch bool
+
 	cmd := &cobra.Command{
 		Use:   "serve",
 		Short: "Start the MCP server",
 		Long:  `Start the knowledge base MCP server`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runServeCommand(f, settings)
+			return runServeCommand(cmd, f, settings, watch)
 		},
 	}
+
+	cmd.Flags().BoolVar(&watch, "watch", false, "re-index changed files while serving")
+	cmd.Flags().DurationVar(&settings.WatchDebounce, "debounce", 500*time.Millisecond,
+		"delay before changes are indexed")
+	cmd.Flags().StringVar(&settings.Transport, "transport", kwb.TransportStdio, "MCP transport: stdio, http or sse")
+	cmd.Flags().StringVar(&settings.ListenAddr, "listen", "127.0.0.1:8080",
+		"address to listen on for http and sse transports, non-loopback addresses require --auth-token")
+	cmd.Flags().StringVar(
+		&settings.AuthToken, "auth-token", os.Getenv("KWB_AUTH_TOKEN"),
+		"bearer token required from http and sse clients (env: KWB_AUTH_TOKEN)",
+	)
+	cmd.Flags().BoolVar(&settings.AllowUnindexedReads, "allow-unindexed", false,
+		"serve any file under the indexed root, not only indexed files")
+	bindIndexFlags(cmd.Flags(), settings)
+
 	return cmd
 }
 
-func runServeCommand(f *cmdutil.Factory, settings *kwb.Settings) error {
+func runServeCommand(cmd *cobra.Command, f *cmdutil.Factory, settings *kwb.Settings, watch bool) error {
 	ctx, cancel := signal.NotifyContext(f.Context(), syscall.SIGTERM, syscall.SIGINT)
 	defer cancel()
 
@@ -32,15 +52,29 @@ func runServeCommand(f *cmdutil.Factory, settings *kwb.Settings) error {
 		return fmt.Errorf("index not found at %s, run 'kwb build' first", settings.IndexPath)
 	}
 
+	roots, err := indexedRoots(cmd.Flags(), settings)
+	if err != nil {
+		return fmt.Errorf("invalid roots: %w", err)
+	}
+
 	service, err := kwb.NewService(
 		settings,
 		kwb.WithLogger(slog.Default().With("component", "kwb-service")),
+		kwb.WithVersion(version.GetVersion()),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create service: %w", err)
 	}
 	defer service.Close() // nolint:errcheck
 
+	if watch {
+		go func() {
+			if err := service.Watch(ctx, roots); err != nil {
+				slog.Default().Error("Watcher stopped", slog.String("error", err.Error()))
+			}
+		}()
+	}
+
 	server := kwb.NewMCPServer(service)
 
 	if err := server.Serve(ctx); err != nil {
@@ -2,6 +2,7 @@ package kwb
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
 
 	"github.com/spf13/cobra"
@@ -11,18 +12,27 @@ import (
 )
 
 func newStatsCommand(f *cmdutil.Factory, settings *kwb.Settings) *cobra.Command {
+	var format string
+
 	cmd := &cobra.Command{
 		Use:   "stats",
 		Short: "Show index statistics",
 		Long:  `Display statistics about the knowledge base index`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runStatsCommand(f, settings)
+			return runStatsCommand(f, cmd.OutOrStdout(), settings, format)
 		},
 	}
+
+	cmd.Flags().StringVar(&format, "format", formatText, "output format: text, json or jsonl")
+
 	return cmd
 }
 
-func runStatsCommand(f *cmdutil.Factory, settings *kwb.Settings) error {
+func runStatsCommand(f *cmdutil.Factory, w io.Writer, settings *kwb.Settings, format string) error {
+	if err := validateFormat(format, formatText, formatJSON, formatJSONL); err != nil {
+		return err
+	}
+
 	if !settings.IndexExists() {
 		return fmt.Errorf("index not found at %s, run 'kwb build' first", settings.IndexPath)
 	}
@@ -41,7 +51,5 @@ func runStatsCommand(f *cmdutil.Factory, settings *kwb.Settings) error {
 		return fmt.Errorf("failed to get stats: %w", err)
 	}
 
-	slog.Default().Info("Index Statistics", slog.Any("stats", stats))
-
-	return nil
+	return writeStats(w, format, stats)
 }
@@ -0,0 +1,63 @@
+package kwb
+
+import (
+	"fmt"
+	"log/slog"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hasansino/go42x/internal/cmdutil"
+	"github.com/hasansino/go42x/internal/version"
+	"github.com/hasansino/go42x/pkg/kwb"
+)
+
+func newWatchCommand(f *cmdutil.Factory, settings *kwb.Settings) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Keep the index up to date with file changes",
+		Long: `Watch the indexed roots and re-index files as they change.
+Roots and indexing options the index was built with are used, unless given.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runWatchCommand(cmd, f, settings)
+		},
+	}
+
+	bindIndexFlags(cmd.Flags(), settings)
+	cmd.Flags().DurationVar(&settings.WatchDebounce, "debounce", 500*time.Millisecond,
+		"delay before changes are indexed")
+
+	return cmd
+}
+
+func runWatchCommand(cmd *cobra.Command, f *cmdutil.Factory, settings *kwb.Settings) error {
+	ctx, cancel := signal.NotifyContext(f.Context(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	if !settings.IndexExists() {
+		return fmt.Errorf("index not found at %s, run 'kwb build' first", settings.IndexPath)
+	}
+
+	roots, err := indexedRoots(cmd.Flags(), settings)
+	if err != nil {
+		return fmt.Errorf("invalid roots: %w", err)
+	}
+
+	service, err := kwb.NewService(
+		settings,
+		kwb.WithLogger(slog.Default().With("component", "kwb-service")),
+		kwb.WithVersion(version.GetVersion()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer service.Close() // nolint:errcheck
+
+	if err := service.Watch(ctx, roots); err != nil {
+		return fmt.Errorf("watch failed: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package kwb
+
+import (
+	"bytes"
+	"fmt"
+	goregexp "regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/regexp"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/registry"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// Analyzers which can be selected for text fields.
+const (
+	AnalyzerCode     = "code"
+	AnalyzerStandard = "standard"
+)
+
+const (
+	codeAnalyzerName       = "kwb_code"
+	codeTokenizerName      = "kwb_identifier"
+	identifierSplitName    = "kwb_identifier_split"
+	identifierAnalyzerName = "kwb_identifier_exact"
+)
+
+// identifierField holds identifiers of content and symbol names unsplit,
+// so exact identifier matches can be ranked above matches of their parts.
+const identifierField = "identifier"
+
+// Boosts of exact matches of query identifiers, declarations named
+// by the identifier are ranked above its other occurrences.
+const (
+	identifierBoost  = 2.0
+	declarationBoost = 5.0
+)
+
+// identifierPattern matches identifiers, including package-qualified ones.
+const identifierPattern = `[\p{L}\p{N}_]+(?:\.[\p{L}\p{N}_]+)*`
+
+var identifierRegexp = goregexp.MustCompile(identifierPattern)
+
+func init() {
+	err := registry.RegisterTokenFilter(identifierSplitName, identifierSplitFilterConstructor)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// analyzerName returns name of bleve analyzer for given setting.
+func analyzerName(analyzer string) string {
+	if analyzer == AnalyzerStandard {
+		return standard.Name
+	}
+	return codeAnalyzerName
+}
+
+// addCodeAnalyzer registers code analyzer in the index mapping,
+// so it is persisted together with the index.
+func addCodeAnalyzer(m *mapping.IndexMappingImpl) error {
+	err := m.AddCustomTokenizer(codeTokenizerName, map[string]interface{}{
+		"type":   regexp.Name,
+		"regexp": identifierPattern,
+	})
+	if err != nil {
+		return fmt.Errorf("adding tokenizer: %w", err)
+	}
+	err = m.AddCustomAnalyzer(codeAnalyzerName, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     codeTokenizerName,
+		"token_filters": []string{identifierSplitName, lowercase.Name},
+	})
+	if err != nil {
+		return fmt.Errorf("adding analyzer: %w", err)
+	}
+	err = m.AddCustomAnalyzer(identifierAnalyzerName, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     codeTokenizerName,
+		"token_filters": []string{lowercase.Name},
+	})
+	if err != nil {
+		return fmt.Errorf("adding identifier analyzer: %w", err)
+	}
+	return nil
+}
+
+// newIdentifierFieldMapping returns mapping which indexes a text field
+// into identifier field as well.
+func newIdentifierFieldMapping() *mapping.FieldMapping {
+	field := bleve.NewTextFieldMapping()
+	field.Name = identifierField
+	field.Store = false
+	field.IncludeInAll = false
+	field.IncludeTermVectors = false
+	field.Analyzer = identifierAnalyzerName
+	return field
+}
+
+// exactIdentifierQuery returns optional clauses boosting documents which contain
+// identifiers of free text unsplit, and declarations named by them.
+// Returns nil if text has no identifiers.
+func exactIdentifierQuery(text string) query.Query {
+	var clauses []query.Query
+	for _, token := range strings.Fields(text) {
+		// Field scoped and excluded terms are not identifiers to look for
+		if strings.HasPrefix(token, "-") || strings.Contains(token, ":") {
+			continue
+		}
+		for _, ident := range identifierRegexp.FindAllString(token, -1) {
+			ident = strings.ToLower(ident)
+
+			exact := bleve.NewTermQuery(ident)
+			exact.SetField(identifierField)
+			exact.SetBoost(identifierBoost)
+
+			declaration := bleve.NewTermQuery(ident)
+			declaration.SetField("name")
+			declaration.SetBoost(declarationBoost)
+
+			clauses = append(clauses, exact, declaration)
+		}
+	}
+	if len(clauses) == 0 {
+		return nil
+	}
+	return bleve.NewDisjunctionQuery(clauses...)
+}
+
+// identifierSplitFilter splits identifiers on dots, underscores, case changes
+// and digits. Original token is kept, and parts share its position,
+// so exact identifier matches score higher than matches of single parts.
+type identifierSplitFilter struct{}
+
+func identifierSplitFilterConstructor(
+	_ map[string]interface{},
+	_ *registry.Cache,
+) (analysis.TokenFilter, error) {
+	return &identifierSplitFilter{}, nil
+}
+
+func (f *identifierSplitFilter) Filter(input analysis.TokenStream) analysis.TokenStream {
+	output := make(analysis.TokenStream, 0, len(input))
+	for _, token := range input {
+		output = append(output, token)
+
+		parts := splitIdentifier(token.Term)
+		if len(parts) < 2 {
+			continue
+		}
+		for _, part := range parts {
+			output = append(output, &analysis.Token{
+				Term:     token.Term[part.start:part.end],
+				Start:    token.Start + part.start,
+				End:      token.Start + part.end,
+				Position: token.Position,
+				Type:     token.Type,
+			})
+		}
+	}
+	return output
+}
+
+type termPart struct {
+	start, end int
+}
+
+// splitIdentifier returns byte ranges of identifier parts.
+// Dotted identifiers produce both segments and their parts,
+// e.g. kwb.NewService -> kwb, NewService, New, Service.
+func splitIdentifier(term []byte) []termPart {
+	var parts []termPart
+	segments := splitBytes(term, '.')
+	for _, seg := range segments {
+		if len(segments) > 1 {
+			parts = append(parts, seg)
+		}
+		words := splitWords(term[seg.start:seg.end])
+		if len(words) < 2 {
+			continue
+		}
+		for _, w := range words {
+			parts = append(parts, termPart{start: seg.start + w.start, end: seg.start + w.end})
+		}
+	}
+	return parts
+}
+
+func splitBytes(term []byte, sep byte) []termPart {
+	var parts []termPart
+	start := 0
+	for {
+		i := bytes.IndexByte(term[start:], sep)
+		if i < 0 {
+			break
+		}
+		if i > 0 {
+			parts = append(parts, termPart{start: start, end: start + i})
+		}
+		start += i + 1
+	}
+	if start < len(term) {
+		parts = append(parts, termPart{start: start, end: len(term)})
+	}
+	return parts
+}
+
+// splitWords splits identifier on underscores, case changes and letter/digit boundaries,
+// e.g. parseHTTPRequest2_v1 -> parse, HTTP, Request, 2, v, 1.
+func splitWords(term []byte) []termPart {
+	var parts []termPart
+	start := -1
+	var prev rune
+
+	flush := func(end int) {
+		if start >= 0 && end > start {
+			parts = append(parts, termPart{start: start, end: end})
+		}
+		start = -1
+	}
+
+	for i := 0; i < len(term); {
+		r, size := utf8.DecodeRune(term[i:])
+		if r == '_' {
+			flush(i)
+			prev = r
+			i += size
+			continue
+		}
+
+		if start >= 0 {
+			boundary := false
+			switch {
+			case unicode.IsLower(prev) && unicode.IsUpper(r):
+				boundary = true
+			case unicode.IsDigit(prev) != unicode.IsDigit(r):
+				boundary = true
+			case unicode.IsUpper(prev) && unicode.IsUpper(r):
+				// Acronym followed by a word: HTTPServer -> HTTP, Server
+				next, _ := utf8.DecodeRune(term[i+size:])
+				boundary = unicode.IsLower(next)
+			}
+			if boundary {
+				flush(i)
+			}
+		}
+		if start < 0 {
+			start = i
+		}
+		prev = r
+		i += size
+	}
+	flush(len(term))
+
+	return parts
+}
@@ -0,0 +1,52 @@
+package kwb
+
+import (
+	"fmt"
+	"strings"
+)
+
+type chunk struct {
+	Content   string
+	StartLine int
+	EndLine   int
+}
+
+// splitLines splits content into lines, keeping line terminators.
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// splitChunks splits lines into windows of size lines, each window
+// repeating last overlap lines of the previous one.
+// Returns nil if content fits into a single window.
+func splitChunks(lines []string, size, overlap int) []chunk {
+	if size <= 0 || len(lines) <= size {
+		return nil
+	}
+	step := size - overlap
+	if step <= 0 {
+		step = size
+	}
+
+	var chunks []chunk
+	for start := 0; start < len(lines); start += step {
+		end := min(start+size, len(lines))
+		chunks = append(chunks, chunk{
+			Content:   strings.Join(lines[start:end], ""),
+			StartLine: start + 1,
+			EndLine:   end,
+		})
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
+
+func chunkID(path string, c chunk) string {
+	return fmt.Sprintf("%s#%s:%d-%d", path, kindChunk, c.StartLine, c.EndLine)
+}
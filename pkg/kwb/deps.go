@@ -0,0 +1,149 @@
+package kwb
+
+import (
+	"go/build"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// typeDependency is the type of every document of a dependency module,
+// regardless of the kind of file it comes from.
+const typeDependency = "dependency"
+
+// parseGoMod returns direct requirements of a go.mod file, with replacements applied.
+// Modules replaced with local directories are dropped, they are not in module cache.
+func parseGoMod(data []byte) ([]module.Version, error) {
+	file, err := modfile.Parse("go.mod", data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	requires := make([]module.Version, 0, len(file.Require))
+	for _, req := range file.Require {
+		if req.Indirect {
+			continue
+		}
+		mod := replacement(file.Replace, req.Mod)
+		if mod.Version == "" {
+			continue
+		}
+		requires = append(requires, mod)
+	}
+	return requires, nil
+}
+
+// replacement returns module mod is replaced with, replacement of the exact version
+// takes precedence over replacement of every version, as in go command.
+func replacement(replaces []*modfile.Replace, mod module.Version) module.Version {
+	replaced, found := mod, false
+	for _, rep := range replaces {
+		if rep.Old.Path != mod.Path {
+			continue
+		}
+		if rep.Old.Version == mod.Version {
+			return rep.New
+		}
+		if rep.Old.Version == "" && !found {
+			replaced, found = rep.New, true
+		}
+	}
+	return replaced
+}
+
+// moduleCacheDir returns root of the module cache, the way go command locates it.
+func moduleCacheDir() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath := filepath.SplitList(build.Default.GOPATH)
+	if len(gopath) == 0 {
+		return ""
+	}
+	return filepath.Join(gopath[0], "pkg", "mod")
+}
+
+// dependencyRoots returns roots of modules directly required by go.mod of each root,
+// located in module cache. Modules which were never downloaded are skipped,
+// nothing is fetched over network.
+func (m *indexManager) dependencyRoots(roots []Root) []Root {
+	cacheDir := moduleCacheDir()
+	if cacheDir == "" {
+		m.logger.Warn("module cache not found, dependencies are not indexed")
+		return nil
+	}
+
+	var deps []Root
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		data, err := os.ReadFile(filepath.Join(root.Path, "go.mod"))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				m.logger.Warn("failed to read go.mod",
+					slog.String("root", root.Path),
+					slog.String("error", err.Error()))
+			}
+			continue
+		}
+		requires, err := parseGoMod(data)
+		if err != nil {
+			m.logger.Warn("failed to parse go.mod",
+				slog.String("root", root.Path),
+				slog.String("error", err.Error()))
+			continue
+		}
+
+		for _, req := range requires {
+			alias := req.Path + "@" + req.Version
+			if seen[alias] {
+				continue
+			}
+			seen[alias] = true
+
+			escapedPath, err := module.EscapePath(req.Path)
+			if err != nil {
+				m.logger.Warn("invalid module path", slog.String("module", req.Path))
+				continue
+			}
+			escapedVersion, err := module.EscapeVersion(req.Version)
+			if err != nil {
+				m.logger.Warn("invalid module version",
+					slog.String("module", req.Path),
+					slog.String("version", req.Version))
+				continue
+			}
+			dir := filepath.Join(cacheDir, escapedPath+"@"+escapedVersion)
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				m.logger.Warn("dependency is not in module cache, run 'go mod download'",
+					slog.String("module", req.Path),
+					slog.String("version", req.Version))
+				continue
+			}
+			deps = append(deps, Root{
+				Alias:   alias,
+				Path:    dir,
+				module:  req.Path,
+				version: req.Version,
+			})
+		}
+	}
+	return deps
+}
+
+// isDependencySource reports whether file of a dependency is worth indexing,
+// tests and test data of dependencies are of no use to their users.
+func isDependencySource(rel string) bool {
+	if strings.HasSuffix(rel, "_test.go") {
+		return false
+	}
+	for _, part := range strings.Split(rel, "/") {
+		if part == "testdata" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package kwb
+
+import (
+	"slices"
+	"testing"
+
+	"golang.org/x/mod/module"
+)
+
+func TestParseGoMod(t *testing.T) {
+	tests := []struct {
+		name    string
+		gomod   string
+		want    []module.Version
+		wantErr bool
+	}{
+		{
+			name: "single line and block requires",
+			gomod: "module example.com/app\n\ngo 1.22\n\n" +
+				"require github.com/Masterminds/semver/v3 v3.2.1\n\n" +
+				"require (\n\tgolang.org/x/text v0.14.0\n\tgolang.org/x/sys v0.35.0 // indirect\n)\n",
+			want: []module.Version{
+				{Path: "github.com/Masterminds/semver/v3", Version: "v3.2.1"},
+				{Path: "golang.org/x/text", Version: "v0.14.0"},
+			},
+		},
+		{
+			name: "quoted path",
+			gomod: "module example.com/app\n\n" +
+				"require \"example.com/quoted\" v1.0.0\n",
+			want: []module.Version{{Path: "example.com/quoted", Version: "v1.0.0"}},
+		},
+		{
+			name: "replacements",
+			gomod: "module example.com/app\n\n" +
+				"require (\n\texample.com/a v1.0.0\n\texample.com/b v1.0.0\n\texample.com/local v1.0.0\n)\n\n" +
+				"replace example.com/a => example.com/fork v1.1.0\n" +
+				"replace (\n\texample.com/b => example.com/any v2.0.0\n" +
+				"\texample.com/b v1.0.0 => example.com/exact v1.0.1\n)\n" +
+				"replace example.com/local => ../local\n",
+			want: []module.Version{
+				{Path: "example.com/fork", Version: "v1.1.0"},
+				{Path: "example.com/exact", Version: "v1.0.1"},
+			},
+		},
+		{
+			name:    "malformed",
+			gomod:   "module example.com/app\n\nrequire example.com/a\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGoMod([]byte(tt.gomod))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGoMod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseGoMod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
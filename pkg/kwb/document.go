@@ -5,11 +5,70 @@ import (
 	"strings"
 )
 
+// Document kinds, a single file can produce several documents.
+const (
+	kindFile    = "file"
+	kindChunk   = "chunk"
+	kindSymbol  = "symbol"
+	kindCommit  = "commit"
+	kindSection = "section"
+)
+
 type document struct {
 	ID      string `json:"id"`
 	Path    string `json:"path"`
 	Content string `json:"content"`
 	Type    string `json:"type"`
+	Ext     string `json:"ext"`
+	Dir     string `json:"dir"`
+	Kind    string `json:"kind"`
+	Repo    string `json:"repo,omitempty"` // alias of the root, empty for unaliased root
+
+	// Module fields, set for documents of dependencies
+	Module        string `json:"module,omitempty"`
+	ModuleVersion string `json:"module_version,omitempty"`
+	Dependency    bool   `json:"dependency"`
+
+	// Line range of content within the file
+	StartLine int `json:"start_line,omitempty"`
+	EndLine   int `json:"end_line,omitempty"`
+
+	// Declaration fields, set for symbol documents
+	Package    string `json:"package,omitempty"`
+	Receiver   string `json:"receiver,omitempty"`
+	Name       string `json:"name,omitempty"`
+	SymbolKind string `json:"symbol_kind,omitempty"`
+	Signature  string `json:"signature,omitempty"`
+	Doc        string `json:"doc,omitempty"`
+	Exported   bool   `json:"exported,omitempty"`
+
+	// Heading path and anchor, set for sections of markdown files
+	Section string `json:"section,omitempty"`
+	Anchor  string `json:"anchor,omitempty"`
+
+	// Commit fields, set for commit documents, content is the diff
+	Commit  string   `json:"commit,omitempty"`
+	Author  string   `json:"author,omitempty"`
+	Date    string   `json:"date,omitempty"` // RFC 3339 in UTC, so it sorts as string
+	Message string   `json:"message,omitempty"`
+	Files   []string `json:"files,omitempty"`
+}
+
+// dirFacetDepth is the number of leading directories stored in dir field.
+const dirFacetDepth = 2
+
+// topLevelDir returns leading directories of path relative to root,
+// e.g. pkg/kwb for pkg/kwb/index.go, "." for files in root.
+func topLevelDir(path string) string {
+	dir := filepath.ToSlash(filepath.Dir(path))
+	if dir == "." {
+		return dir
+	}
+	parts := strings.Split(dir, "/")
+	if len(parts) > dirFacetDepth {
+		parts = parts[:dirFacetDepth]
+	}
+	return strings.Join(parts, "/")
 }
 
 func getFileType(path string) string {
@@ -46,3 +105,31 @@ func getFileType(path string) string {
 		return "other"
 	}
 }
+
+// getMIMEType returns MIME type of a file by its type.
+func getMIMEType(path string) string {
+	switch getFileType(path) {
+	case "code":
+		return "text/x-go"
+	case "documentation":
+		return "text/markdown"
+	case "config":
+		return "application/yaml"
+	case "proto":
+		return "text/x-protobuf"
+	case "sql":
+		return "application/sql"
+	case "json":
+		return "application/json"
+	case "toml":
+		return "application/toml"
+	case "shell":
+		return "application/x-sh"
+	case "makefile":
+		return "text/x-makefile"
+	case "dockerfile":
+		return "text/x-dockerfile"
+	default:
+		return "text/plain"
+	}
+}
@@ -0,0 +1,246 @@
+package kwb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Embedders which can be selected in settings.
+const (
+	EmbedderHash   = "hash"
+	EmbedderOpenAI = "openai"
+	EmbedderNone   = "none"
+)
+
+// Embedder converts texts into vectors, so that texts with similar meaning
+// produce vectors with high cosine similarity.
+type Embedder interface {
+	// Name identifies the model, vectors produced by different models are not comparable.
+	Name() string
+	// Embed returns one vector per text.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// newEmbedder creates embedder selected in settings, nil if embeddings are disabled.
+func newEmbedder(settings *Settings) Embedder {
+	switch settings.Embedder {
+	case EmbedderNone:
+		return nil
+	case EmbedderOpenAI:
+		return NewOpenAIEmbedder(settings.EmbeddingURL, settings.EmbeddingModel, settings.EmbeddingAPIKey)
+	default:
+		return NewHashEmbedder(defaultHashDimensions)
+	}
+}
+
+const defaultHashDimensions = 512
+
+var wordPattern = regexp.MustCompile(identifierPattern)
+
+// stopWords carry no meaning on their own and would dominate similarity.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"do": true, "does": true, "for": true, "from": true, "how": true, "in": true, "is": true, "it": true,
+	"of": true, "on": true, "or": true, "that": true, "the": true, "this": true, "to": true, "we": true,
+	"what": true, "when": true, "where": true, "which": true, "who": true, "with": true,
+	"err": true, "nil": true, "func": true, "return": true, "if": true, "var": true, "const": true,
+}
+
+// HashEmbedder is an offline embedder which projects words and their character
+// trigrams into a fixed number of dimensions by hashing.
+// It captures vocabulary overlap, including different forms of the same word,
+// rather than meaning, but needs no model and is deterministic.
+type HashEmbedder struct {
+	dimensions int
+}
+
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	return &HashEmbedder{dimensions: dimensions}
+}
+
+func (e *HashEmbedder) Name() string {
+	return fmt.Sprintf("%s-%d", EmbedderHash, e.dimensions)
+}
+
+func (e *HashEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vectors = append(vectors, e.embed(text))
+	}
+	return vectors, nil
+}
+
+func (e *HashEmbedder) embed(text string) []float32 {
+	counts := make(map[string]int)
+	for _, word := range textWords(text) {
+		counts[word]++
+		// Trigrams match different forms of a word, e.g. retry and retries
+		padded := "^" + word + "$"
+		for i := 0; i+3 <= len(padded); i++ {
+			counts["#"+padded[i:i+3]]++
+		}
+	}
+
+	vector := make([]float32, e.dimensions)
+	for feature, count := range counts {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(feature))
+		sum := h.Sum64()
+
+		weight := 1 + math.Log(float64(count))
+		if strings.HasPrefix(feature, "#") {
+			weight /= 2
+		}
+		// Sign bit keeps collisions from adding up
+		if sum&(1<<63) != 0 {
+			weight = -weight
+		}
+		vector[sum%uint64(e.dimensions)] += float32(weight)
+	}
+	return normalize(vector)
+}
+
+// textWords splits text into lowercase words, identifiers are split into their parts.
+func textWords(text string) []string {
+	var words []string
+	for _, token := range wordPattern.FindAllString(text, -1) {
+		// Identifier is a word of its own, as well as each of its parts
+		parts := append([]termPart{{start: 0, end: len(token)}}, splitIdentifier([]byte(token))...)
+		for _, part := range parts {
+			word := strings.ToLower(token[part.start:part.end])
+			if len(word) < 2 || stopWords[word] || strings.Contains(word, ".") {
+				continue
+			}
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// normalize scales vector to unit length, so cosine similarity is a dot product.
+func normalize(vector []float32) []float32 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return vector
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector
+}
+
+const (
+	openAIBatchSize   = 64
+	openAIMaxChars    = 8000 // inputs are truncated to stay within model context
+	openAIHTTPTimeout = time.Minute
+)
+
+// OpenAIEmbedder calls embeddings endpoint of an OpenAI-compatible API,
+// such as the ones served by Ollama, LM Studio or llama.cpp.
+type OpenAIEmbedder struct {
+	baseURL string
+	model   string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewOpenAIEmbedder creates embedder for API at baseURL, e.g. http://localhost:11434/v1.
+func NewOpenAIEmbedder(baseURL, model, apiKey string) *OpenAIEmbedder {
+	return &OpenAIEmbedder{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		model:   model,
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: openAIHTTPTimeout},
+	}
+}
+
+func (e *OpenAIEmbedder) Name() string {
+	return EmbedderOpenAI + ":" + e.model
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += openAIBatchSize {
+		end := min(start+openAIBatchSize, len(texts))
+		batch, err := e.embedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+type openAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *OpenAIEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	input := make([]string, 0, len(texts))
+	for _, text := range texts {
+		if len(text) > openAIMaxChars {
+			text = text[:openAIMaxChars]
+		}
+		input = append(input, text)
+	}
+
+	body, err := json.Marshal(openAIEmbeddingRequest{Model: e.model, Input: input})
+	if err != nil {
+		return nil, fmt.Errorf("encoding request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting embeddings: %w", err)
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("requesting embeddings: unexpected status %s", resp.Status)
+	}
+
+	var result openAIEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	if len(result.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(result.Data))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", item.Index)
+		}
+		vectors[item.Index] = normalize(item.Embedding)
+	}
+	return vectors, nil
+}
@@ -0,0 +1,194 @@
+package kwb
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// FileRange is a range of lines of a file.
+type FileRange struct {
+	Path       string   `json:"path"`
+	StartLine  int      `json:"start_line"`
+	EndLine    int      `json:"end_line"`
+	TotalLines int      `json:"total_lines"`
+	Lines      []string `json:"lines"` // without line terminators
+}
+
+// Symbol is a top-level declaration of a file.
+type Symbol struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Receiver  string `json:"receiver,omitempty"`
+	Signature string `json:"signature"`
+	Exported  bool   `json:"exported"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+}
+
+// resolveFile maps requested file to a file under indexed root.
+// File is given by its id, e.g. "api:cmd/main.go", or by path relative to its root,
+// in which case every root is tried and the path must match exactly one of them.
+// Unless unindexed reads are allowed, only indexed files are resolved.
+func (s *searcher) resolveFile(file string) (string, error) {
+	index, err := s.indexManager.GetIndex()
+	if err != nil {
+		return "", fmt.Errorf("getting index: %w", err)
+	}
+	mf, err := loadManifest(index)
+	if err != nil {
+		return "", err
+	}
+	if mf == nil || len(mf.Roots) == 0 {
+		return "", fmt.Errorf("index does not record its roots, rebuild it with 'kwb build'")
+	}
+
+	alias, path := mf.splitID(file)
+	var roots []manifestRoot
+	if alias != "" {
+		root, _ := mf.root(alias)
+		roots = []manifestRoot{root}
+	} else {
+		// Files of dependencies are only resolved with module@version prefix
+		for _, root := range mf.Roots {
+			if root.Module == "" {
+				roots = append(roots, root)
+			}
+		}
+	}
+
+	var (
+		resolved []string
+		repos    []string
+		lastErr  error
+	)
+	for _, root := range roots {
+		target, err := s.resolveInRoot(mf, root, path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resolved = append(resolved, target)
+		repos = append(repos, root.Alias)
+	}
+	switch len(resolved) {
+	case 0:
+		return "", lastErr
+	case 1:
+		return resolved[0], nil
+	default:
+		return "", fmt.Errorf("%s exists in several repos (%s), prefix it with repo, e.g. %s",
+			path, strings.Join(repos, ", "), fileID(repos[0], path))
+	}
+}
+
+// resolveInRoot resolves path relative to root, absolute path must be located under root.
+func (s *searcher) resolveInRoot(mf *manifest, root manifestRoot, path string) (string, error) {
+	candidate := filepath.Clean(filepath.Join(root.Dir, path))
+	if filepath.IsAbs(path) {
+		candidate = filepath.Clean(path)
+	}
+	if !isWithinDir(root.Dir, candidate) {
+		return "", fmt.Errorf("%s is outside of indexed root", path)
+	}
+	rel, err := filepath.Rel(root.Dir, candidate)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s: %w", path, err)
+	}
+	if _, ok := mf.Files[fileID(root.Alias, filepath.ToSlash(rel))]; !ok && !s.settings.AllowUnindexedReads {
+		return "", fmt.Errorf("%s is not indexed", path)
+	}
+
+	// Symlinks may point anywhere, target must stay under root too
+	resolved, err := filepath.EvalSymlinks(candidate)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s: %w", path, err)
+	}
+	rootDir, err := filepath.EvalSymlinks(root.Dir)
+	if err != nil {
+		return "", fmt.Errorf("resolving root: %w", err)
+	}
+	if !isWithinDir(rootDir, resolved) {
+		return "", fmt.Errorf("%s resolves outside of indexed root", path)
+	}
+	return resolved, nil
+}
+
+// isWithinDir reports whether path is dir or is located beneath it.
+// Both paths must be absolute and clean.
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// GetFileRange returns lines start through end of a file, both 1-based and inclusive.
+// End beyond the last line, or 0, selects everything up to the end of file.
+func (s *searcher) GetFileRange(path string, start, end int) (*FileRange, error) {
+	if start < 1 {
+		return nil, fmt.Errorf("start line must be greater than 0")
+	}
+	if end != 0 && end < start {
+		return nil, fmt.Errorf("end line %d is before start line %d", end, start)
+	}
+
+	content, err := s.GetFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := splitLines(content)
+	if start > len(lines) {
+		return nil, fmt.Errorf("start line %d is beyond end of file (%d lines)", start, len(lines))
+	}
+	if end == 0 || end > len(lines) {
+		end = len(lines)
+	}
+
+	r := &FileRange{
+		Path:       path,
+		StartLine:  start,
+		EndLine:    end,
+		TotalLines: len(lines),
+		Lines:      make([]string, 0, end-start+1),
+	}
+	for _, line := range lines[start-1 : end] {
+		r.Lines = append(r.Lines, strings.TrimRight(line, "\r\n"))
+	}
+	return r, nil
+}
+
+// Outline returns declarations of a Go, protobuf or SQL file in source order.
+// Go files list top-level declarations only, others list nested ones as well.
+func (s *searcher) Outline(path string) ([]Symbol, error) {
+	parse, ok := symbolParsers[filepath.Ext(path)]
+	if !ok {
+		return nil, fmt.Errorf("outline is not supported for %s files", getFileType(path))
+	}
+
+	content, err := s.GetFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := parse(path, []byte(content))
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := make([]Symbol, 0, len(docs))
+	for _, doc := range docs {
+		symbols = append(symbols, Symbol{
+			Name:      doc.Name,
+			Kind:      doc.SymbolKind,
+			Receiver:  doc.Receiver,
+			Signature: doc.Signature,
+			Exported:  doc.Exported,
+			StartLine: doc.StartLine,
+			EndLine:   doc.EndLine,
+		})
+	}
+	return symbols, nil
+}
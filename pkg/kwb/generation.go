@@ -0,0 +1,232 @@
+package kwb
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// Index path is a symlink to the directory of current index generation.
+// Builds write a new generation next to it and then replace the link,
+// so processes which have previous generation open are never disturbed.
+// Replaced generation is kept until the next publish, older ones are removed then,
+// unless some process still has them open.
+
+const generationInfix = ".gen-"
+
+// generationLockFile is locked shared by every process which has the generation open.
+const generationLockFile = "kwb.lock"
+
+// lockFile opens file at path, creating it if needed, and applies flock operation to it.
+// Lock is released when the file is closed.
+func lockFile(path string, how int) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// lockWrites takes exclusive lock on index path shared by all processes writing to it.
+// Builds hold it from copying current generation until the new one is published,
+// so neither a torn copy is made, nor updates written in between are lost.
+func lockWrites(indexPath string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(indexPath), 0755); err != nil {
+		return nil, fmt.Errorf("creating index directory: %w", err)
+	}
+	lock, err := lockFile(indexPath+".lock", syscall.LOCK_EX)
+	if err != nil {
+		return nil, fmt.Errorf("locking index: %w", err)
+	}
+	return lock, nil
+}
+
+// newGeneration creates empty directory for the next generation of index.
+func newGeneration(indexPath string) (string, error) {
+	parent := filepath.Dir(indexPath)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", fmt.Errorf("creating index directory: %w", err)
+	}
+	dir, err := os.MkdirTemp(parent, filepath.Base(indexPath)+generationInfix)
+	if err != nil {
+		return "", fmt.Errorf("creating index generation: %w", err)
+	}
+	return dir, nil
+}
+
+// copyIndex copies index files of current generation into dst.
+func copyIndex(indexPath, dst string) error {
+	src, err := filepath.EvalSymlinks(indexPath)
+	if err != nil {
+		return fmt.Errorf("resolving index path: %w", err)
+	}
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if rel == generationLockFile {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close() // nolint:errcheck
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// isGenerationDir reports whether path is the index path or any generation of it.
+func isGenerationDir(indexPath, path string) bool {
+	absIndex, errIndex := filepath.Abs(indexPath)
+	absPath, errPath := filepath.Abs(path)
+	if errIndex != nil || errPath != nil || filepath.Dir(absIndex) != filepath.Dir(absPath) {
+		return false
+	}
+	base := filepath.Base(absIndex)
+	name := filepath.Base(absPath)
+	return name == base || name == base+".old" || strings.HasPrefix(name, base+generationInfix)
+}
+
+// publishGeneration atomically points index path to dir.
+// Previous generation is kept for processes which still have it open,
+// generations replaced before it are removed.
+func publishGeneration(indexPath, dir string) error {
+	link := dir + ".link"
+	if err := os.Symlink(filepath.Base(dir), link); err != nil {
+		return fmt.Errorf("creating index link: %w", err)
+	}
+
+	var previous string
+	info, err := os.Lstat(indexPath)
+	switch {
+	case err == nil && info.Mode()&os.ModeSymlink != 0:
+		previous, _ = filepath.EvalSymlinks(indexPath)
+	case err == nil:
+		// Indexes built by older versions are plain directories,
+		// a link can not replace a directory, so it is moved aside first.
+		previous = indexPath + ".old"
+		if err := os.RemoveAll(previous); err != nil {
+			return fmt.Errorf("removing old index: %w", err)
+		}
+		if err := os.Rename(indexPath, previous); err != nil {
+			return fmt.Errorf("moving old index: %w", err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("checking index path: %w", err)
+	}
+
+	if err := os.Rename(link, indexPath); err != nil {
+		_ = os.Remove(link)
+		return fmt.Errorf("replacing index: %w", err)
+	}
+
+	return removeGenerations(indexPath, dir, previous)
+}
+
+// removeGenerations removes generations of index path other than the given ones.
+// Generations opened by any process are kept, they are removed by a later publish
+// once every process has reopened the current one. Caller must hold write lock,
+// so no other build has a generation in progress.
+func removeGenerations(indexPath string, keep ...string) error {
+	parent := filepath.Dir(indexPath)
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return fmt.Errorf("listing index generations: %w", err)
+	}
+	var kept []os.FileInfo
+	for _, dir := range keep {
+		if info, err := os.Stat(dir); dir != "" && err == nil {
+			kept = append(kept, info)
+		}
+	}
+	for _, entry := range entries {
+		path := filepath.Join(parent, entry.Name())
+		if !entry.IsDir() || !isGenerationDir(indexPath, path) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || containsFile(kept, info) {
+			continue
+		}
+		lock, err := lockFile(filepath.Join(path, generationLockFile), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err != nil {
+			continue // still open
+		}
+		err = os.RemoveAll(path)
+		_ = lock.Close()
+		if err != nil {
+			return fmt.Errorf("removing index generation: %w", err)
+		}
+	}
+	return nil
+}
+
+func containsFile(infos []os.FileInfo, info os.FileInfo) bool {
+	for _, other := range infos {
+		if os.SameFile(other, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// generationChange lists files which differ between previous and current generation.
+func generationChange(previous, current bleve.Index) IndexChange {
+	var change IndexChange
+	before, errBefore := loadManifest(previous)
+	after, errAfter := loadManifest(current)
+	if errBefore != nil || errAfter != nil || before == nil || after == nil {
+		return change
+	}
+	for id, entry := range after.Files {
+		prev, ok := before.Files[id]
+		switch {
+		case !ok:
+			change.Added = append(change.Added, id)
+		case prev.Hash != entry.Hash:
+			change.Updated = append(change.Updated, id)
+		}
+	}
+	for id := range before.Files {
+		if _, ok := after.Files[id]; !ok {
+			change.Removed = append(change.Removed, id)
+		}
+	}
+	sort.Strings(change.Added)
+	sort.Strings(change.Updated)
+	sort.Strings(change.Removed)
+	return change
+}
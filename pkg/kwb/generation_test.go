@@ -0,0 +1,208 @@
+package kwb
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildIndex_SkipsGenerations(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := &Settings{
+		IndexPath:   filepath.Join(root, "kb.index"),
+		MaxFileSize: 1024 * 1024,
+		BatchSize:   100,
+		IndexType:   "scorch",
+	}
+	m := newIndexManager(settings, "test", nil, slog.New(slog.DiscardHandler))
+	roots := []Root{{Path: root}}
+
+	if err := m.BuildIndex(roots); err != nil {
+		t.Fatalf("first BuildIndex() error = %v", err)
+	}
+	first, err := filepath.EvalSymlinks(settings.IndexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.BuildIndex(roots); err != nil {
+		t.Fatalf("second BuildIndex() error = %v", err)
+	}
+	if _, err := os.Stat(first); err != nil {
+		t.Errorf("replaced generation was removed: %v", err)
+	}
+
+	index, err := m.GetIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.CloseIndex() // nolint:errcheck
+
+	mf, err := loadManifest(index)
+	if err != nil || mf == nil {
+		t.Fatalf("loadManifest() = %v, %v", mf, err)
+	}
+	for id := range mf.Files {
+		if strings.HasPrefix(id, "kb.index") {
+			t.Errorf("index generation file %s was indexed", id)
+		}
+	}
+	if _, ok := mf.Files["main.go"]; !ok {
+		t.Errorf("main.go was not indexed, files: %v", mf.Files)
+	}
+}
+
+func TestGetIndex_AnnouncesPublishedGeneration(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("main.go", "package main\n")
+	write("old.go", "package main\n")
+
+	settings := &Settings{
+		IndexPath:   filepath.Join(t.TempDir(), "kb.index"),
+		MaxFileSize: 1024 * 1024,
+		BatchSize:   100,
+		IndexType:   "scorch",
+	}
+	logger := slog.New(slog.DiscardHandler)
+	roots := []Root{{Path: root}}
+	if err := newIndexManager(settings, "test", nil, logger).BuildIndex(roots); err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+
+	serving := newIndexManager(settings, "test", nil, logger)
+	defer serving.CloseIndex() // nolint:errcheck
+	if _, err := serving.GetIndex(); err != nil {
+		t.Fatal(err)
+	}
+	var changes []IndexChange
+	serving.onChange(func(change IndexChange) {
+		changes = append(changes, change)
+	})
+
+	// Another process rebuilds the index
+	write("main.go", "package main\n\nfunc main() {}\n")
+	write("new.go", "package main\n")
+	if err := os.Remove(filepath.Join(root, "old.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := newIndexManager(settings, "test", nil, logger).BuildIndex(roots); err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+
+	if _, err := serving.GetIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes, want 1", len(changes))
+	}
+	change := changes[0]
+	if !slices.Equal(change.Added, []string{"new.go"}) ||
+		!slices.Equal(change.Updated, []string{"main.go"}) ||
+		!slices.Equal(change.Removed, []string{"old.go"}) {
+		t.Errorf("change = %+v", change)
+	}
+}
+
+func TestBuildIndex_KeepsOpenGenerations(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings := &Settings{
+		IndexPath:   filepath.Join(t.TempDir(), "kb.index"),
+		MaxFileSize: 1024 * 1024,
+		BatchSize:   100,
+		IndexType:   "scorch",
+	}
+	logger := slog.New(slog.DiscardHandler)
+	roots := []Root{{Path: root}}
+	build := func() {
+		t.Helper()
+		if err := newIndexManager(settings, "test", nil, logger).BuildIndex(roots); err != nil {
+			t.Fatalf("BuildIndex() error = %v", err)
+		}
+	}
+
+	build()
+	first, err := filepath.EvalSymlinks(settings.IndexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Idle process keeps the first generation open while others are published
+	idle := newIndexManager(settings, "test", nil, logger)
+	if err := idle.OpenIndex(); err != nil {
+		t.Fatal(err)
+	}
+	build()
+	build()
+	if _, err := os.Stat(first); err != nil {
+		t.Fatalf("open generation was removed: %v", err)
+	}
+
+	if err := idle.CloseIndex(); err != nil {
+		t.Fatal(err)
+	}
+	build()
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("closed generation was not removed: %v", err)
+	}
+}
+
+func TestUpdateFiles_WaitsForBuild(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "main.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings := &Settings{
+		IndexPath:   filepath.Join(t.TempDir(), "kb.index"),
+		MaxFileSize: 1024 * 1024,
+		BatchSize:   100,
+		IndexType:   "scorch",
+	}
+	m := newIndexManager(settings, "test", nil, slog.New(slog.DiscardHandler))
+	roots := []Root{{Path: root}}
+	if err := m.BuildIndex(roots); err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+	defer m.CloseIndex() // nolint:errcheck
+
+	// Lock is held the same way by a build running in another process
+	lock, err := lockWrites(settings.IndexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- m.UpdateFiles(roots, []string{path})
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("UpdateFiles() = %v while index is locked", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := lock.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("UpdateFiles() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("UpdateFiles() did not finish after lock was released")
+	}
+}
@@ -0,0 +1,169 @@
+package kwb
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+const (
+	symbolFunc   = "func"
+	symbolMethod = "method"
+	symbolType   = "type"
+	symbolConst  = "const"
+	symbolVar    = "var"
+)
+
+// parseGoSymbols extracts top-level declarations of a Go file as separate documents.
+func parseGoSymbols(path string, content []byte) ([]document, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, content, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("parsing go file: %w", err)
+	}
+
+	p := &goSymbolParser{
+		fset:    fset,
+		path:    path,
+		pkg:     file.Name.Name,
+		content: content,
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			p.addFunc(d)
+		case *ast.GenDecl:
+			p.addGen(d)
+		}
+	}
+
+	return p.docs, nil
+}
+
+type goSymbolParser struct {
+	fset    *token.FileSet
+	path    string
+	pkg     string
+	content []byte
+	docs    []document
+}
+
+func (p *goSymbolParser) addFunc(d *ast.FuncDecl) {
+	kind := symbolFunc
+	receiver := ""
+	if d.Recv != nil && len(d.Recv.List) > 0 {
+		kind = symbolMethod
+		receiver = p.print(d.Recv.List[0].Type)
+	}
+
+	// Signature is the declaration without body and comments
+	sig := *d
+	sig.Doc = nil
+	sig.Body = nil
+
+	p.add(d.Name.Name, kind, receiver, p.print(&sig), d.Doc, d)
+}
+
+func (p *goSymbolParser) addGen(d *ast.GenDecl) {
+	var kind string
+	switch d.Tok {
+	case token.TYPE:
+		kind = symbolType
+	case token.CONST:
+		kind = symbolConst
+	case token.VAR:
+		kind = symbolVar
+	default:
+		return
+	}
+
+	for _, spec := range d.Specs {
+		// Grouped specs are symbols of their own, ungrouped spec spans the whole decl
+		var node ast.Node = d
+		doc := d.Doc
+		if d.Lparen.IsValid() {
+			node = spec
+			doc = nil
+		}
+
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			if s.Doc != nil {
+				doc = s.Doc
+			}
+			p.add(s.Name.Name, kind, "", p.typeSignature(s), doc, node)
+		case *ast.ValueSpec:
+			if s.Doc != nil {
+				doc = s.Doc
+			}
+			sig := *s
+			sig.Doc = nil
+			sig.Comment = nil
+			for _, name := range s.Names {
+				p.add(name.Name, kind, "", d.Tok.String()+" "+p.print(&sig), doc, node)
+			}
+		}
+	}
+}
+
+func (p *goSymbolParser) add(name, kind, receiver, signature string, doc *ast.CommentGroup, node ast.Node) {
+	if name == "_" {
+		return
+	}
+
+	start := node.Pos()
+	if doc != nil {
+		start = doc.Pos()
+	}
+	startPos := p.fset.Position(start)
+	endPos := p.fset.Position(node.End())
+
+	qualified := name
+	if receiver != "" {
+		qualified = strings.TrimPrefix(receiver, "*") + "." + name
+	}
+
+	p.docs = append(p.docs, document{
+		ID:         fmt.Sprintf("%s#%s:%s:%d", p.path, kindSymbol, qualified, startPos.Line),
+		Path:       p.path,
+		Content:    string(p.content[startPos.Offset:endPos.Offset]),
+		Type:       getFileType(p.path),
+		Kind:       kindSymbol,
+		Package:    p.pkg,
+		Receiver:   receiver,
+		Name:       name,
+		SymbolKind: kind,
+		Signature:  signature,
+		Doc:        strings.TrimSpace(doc.Text()),
+		Exported:   ast.IsExported(name),
+		StartLine:  startPos.Line,
+		EndLine:    endPos.Line,
+	})
+}
+
+// typeSignature prints type declaration, omitting struct and interface bodies.
+func (p *goSymbolParser) typeSignature(s *ast.TypeSpec) string {
+	sig := *s
+	sig.Doc = nil
+	sig.Comment = nil
+	switch s.Type.(type) {
+	case *ast.StructType:
+		sig.Type = ast.NewIdent("struct")
+	case *ast.InterfaceType:
+		sig.Type = ast.NewIdent("interface")
+	}
+	return "type " + p.print(&sig)
+}
+
+func (p *goSymbolParser) print(node any) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, p.fset, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
@@ -0,0 +1,83 @@
+package kwb
+
+import (
+	"testing"
+)
+
+func TestParseGoSymbols(t *testing.T) {
+	src := `package store
+
+// Store keeps items.
+type Store struct {
+	items map[string]int
+}
+
+// Get returns item by key.
+func (s *Store) Get(key string) (int, bool) {
+	v, ok := s.items[key]
+	return v, ok
+}
+
+func newStore() *Store {
+	return &Store{}
+}
+
+const (
+	// MaxItems limits the store.
+	MaxItems = 100
+	minItems = 1
+)
+
+var _ = newStore
+
+type (
+	Reader interface {
+		Get(key string) (int, bool)
+	}
+	ID = string
+)
+`
+	type symbol struct {
+		kind, receiver, name, signature, doc string
+		start, end                           int
+		exported                             bool
+	}
+	want := []symbol{
+		{symbolType, "", "Store", "type Store struct", "Store keeps items.", 3, 6, true},
+		{
+			symbolMethod, "*Store", "Get", "func (s *Store) Get(key string) (int, bool)",
+			"Get returns item by key.", 8, 12, true,
+		},
+		{symbolFunc, "", "newStore", "func newStore() *Store", "", 14, 16, false},
+		{symbolConst, "", "MaxItems", "const MaxItems = 100", "MaxItems limits the store.", 19, 20, true},
+		{symbolConst, "", "minItems", "const minItems = 1", "", 21, 21, false},
+		{symbolType, "", "Reader", "type Reader interface", "", 27, 29, true},
+		{symbolType, "", "ID", "type ID = string", "", 30, 30, true},
+	}
+
+	docs, err := parseGoSymbols("store/store.go", []byte(src))
+	if err != nil {
+		t.Fatalf("parseGoSymbols() error = %v", err)
+	}
+	if len(docs) != len(want) {
+		t.Fatalf("got %d symbols, want %d: %q", len(docs), len(want), symbolSummary(docs))
+	}
+	for i, doc := range docs {
+		got := symbol{
+			doc.SymbolKind, doc.Receiver, doc.Name, doc.Signature, doc.Doc,
+			doc.StartLine, doc.EndLine, doc.Exported,
+		}
+		if got != want[i] {
+			t.Errorf("symbol %d = %+v, want %+v", i, got, want[i])
+		}
+		if doc.Kind != kindSymbol || doc.Package != "store" {
+			t.Errorf("symbol %s has kind %s and package %s", doc.Name, doc.Kind, doc.Package)
+		}
+	}
+}
+
+func TestParseGoSymbols_Invalid(t *testing.T) {
+	if _, err := parseGoSymbols("broken.go", []byte("package broken\n\nfunc {")); err == nil {
+		t.Error("parseGoSymbols() of invalid source succeeded")
+	}
+}
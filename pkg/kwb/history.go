@@ -0,0 +1,376 @@
+package kwb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// typeCommit is the type of commit documents.
+const typeCommit = "commit"
+
+const (
+	// historyDiffSize bounds diff stored with a commit, large commits are mostly generated code.
+	historyDiffSize = 16 * 1024
+	// historyOutputLimit bounds output of git read for a single commit.
+	historyOutputLimit = 1024 * 1024
+)
+
+// commit is a commit read from git repository.
+type commit struct {
+	Hash    string
+	Author  string
+	Date    time.Time
+	Message string
+	Paths   []string // paths touched by the commit, relative to repository root
+	Diff    string
+}
+
+// commitID returns id of the document of a commit of repo.
+func commitID(repo, hash string) string {
+	return fileID(repo, "commit:"+hash)
+}
+
+// listCommits returns hashes of the last n commits reachable from HEAD, newest first.
+func listCommits(dir string, n int) ([]string, error) {
+	out, err := exec.Command("git", "-C", dir, "log", "-n", fmt.Sprint(n), "--format=%H").Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing commits: %w", err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// readCommit reads metadata, touched paths and diff of a commit.
+func readCommit(dir, hash string) (*commit, error) {
+	cmd := exec.Command("git", "-C", dir, "show",
+		"--no-color", "--no-ext-diff", "--raw", "--patch",
+		"--format=%H%x00%an <%ae>%x00%aI%x00%B%x00", hash)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("reading commit %s: %w", hash, err)
+	}
+	out, err := io.ReadAll(io.LimitReader(stdout, historyOutputLimit))
+	// Rest of a huge diff is not needed
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+	if err != nil {
+		return nil, fmt.Errorf("reading commit %s: %w", hash, err)
+	}
+	return parseCommit(string(out))
+}
+
+// parseCommit parses output of git show with metadata separated by NUL,
+// followed by raw diff lines and patch.
+func parseCommit(out string) (*commit, error) {
+	parts := strings.SplitN(out, "\x00", 5)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("unexpected output of git show")
+	}
+	date, err := time.Parse(time.RFC3339, parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("parsing commit date: %w", err)
+	}
+	c := &commit{
+		Hash:    strings.TrimSpace(parts[0]),
+		Author:  parts[1],
+		Date:    date.UTC(),
+		Message: strings.TrimSpace(parts[3]),
+	}
+
+	rest := parts[4]
+	for len(rest) > 0 {
+		line, next, _ := strings.Cut(rest, "\n")
+		if strings.HasPrefix(line, "diff ") {
+			break
+		}
+		// Raw line is ":<modes> <hashes> <status>\t<path>[\t<new path>]"
+		if strings.HasPrefix(line, ":") {
+			if _, paths, ok := strings.Cut(line, "\t"); ok {
+				c.Paths = append(c.Paths, strings.Split(paths, "\t")...)
+			}
+		}
+		rest = next
+	}
+	c.Diff = rest
+	return c, nil
+}
+
+// sanitizeCommit prepares commit for indexing: drops diffs of denied files,
+// masks secrets in message and diff and truncates diff to historyDiffSize.
+// Returns the number of masked secrets.
+func (m *indexManager) sanitizeCommit(c *commit) int {
+	diff, diffRedactions := redactSecrets([]byte(filterDiff(c.Diff, m.isDeniedFile)))
+	message, messageRedactions := redactSecrets([]byte(c.Message))
+	c.Diff = truncateDiff(string(diff), historyDiffSize)
+	c.Message = string(message)
+	return diffRedactions + messageRedactions
+}
+
+// filterDiff removes sections of files whose name is denied from a git diff.
+func filterDiff(diff string, denied func(name string) bool) string {
+	var out strings.Builder
+	keep := true
+	for len(diff) > 0 {
+		line, rest, found := strings.Cut(diff, "\n")
+		if strings.HasPrefix(line, "diff --git ") {
+			keep = true
+			for _, path := range diffPaths(line) {
+				if denied(path[strings.LastIndexByte(path, '/')+1:]) {
+					keep = false
+				}
+			}
+		}
+		if keep {
+			out.WriteString(line)
+			if found {
+				out.WriteByte('\n')
+			}
+		}
+		diff = rest
+	}
+	return out.String()
+}
+
+// diffPaths returns old and new path from "diff --git a/<path> b/<path>" header.
+func diffPaths(header string) []string {
+	paths := strings.TrimPrefix(header, "diff --git ")
+	i := strings.LastIndex(paths, " b/")
+	if i < 0 {
+		i = strings.LastIndex(paths, ` "b/`)
+	}
+	if i < 0 {
+		return []string{paths}
+	}
+	return []string{strings.Trim(paths[:i], `"`), strings.Trim(paths[i+1:], `"`)}
+}
+
+// truncateDiff cuts diff at the last line break within size.
+func truncateDiff(diff string, size int) string {
+	if len(diff) <= size {
+		return diff
+	}
+	cut := strings.LastIndexByte(diff[:size], '\n')
+	if cut < 0 {
+		cut = size
+	}
+	return diff[:cut] + "\n... diff truncated\n"
+}
+
+// commitDocument converts commit of repo into a document, diff is its content.
+func commitDocument(repo string, c *commit) document {
+	return document{
+		ID:      commitID(repo, c.Hash),
+		Path:    c.Hash,
+		Content: c.Diff,
+		Type:    typeCommit,
+		Kind:    kindCommit,
+		Repo:    repo,
+		Commit:  c.Hash,
+		Author:  c.Author,
+		Date:    c.Date.Format(time.RFC3339),
+		Message: c.Message,
+		Files:   c.Paths,
+	}
+}
+
+// syncHistory indexes the last commits of every root which is a git repository,
+// and removes commits which are no longer among them.
+// Returns number of added and removed commits.
+func (m *indexManager) syncHistory(batch *bleve.Batch, mf *manifest, roots []Root) (int, int) {
+	indexed := mf.Commits
+	mf.Commits = make(map[string][]string)
+
+	added := 0
+	for _, root := range roots {
+		if m.settings.HistoryCommits <= 0 || root.module != "" {
+			continue
+		}
+		hashes, err := listCommits(root.Path, m.settings.HistoryCommits)
+		if err != nil {
+			m.logger.Warn("failed to read git history",
+				slog.String("root", root.Path),
+				slog.String("error", err.Error()))
+			mf.Commits[root.Alias] = indexed[root.Alias]
+			continue
+		}
+
+		known := make(map[string]bool, len(indexed[root.Alias]))
+		for _, hash := range indexed[root.Alias] {
+			known[hash] = true
+		}
+		for _, hash := range hashes {
+			if !known[hash] {
+				c, err := readCommit(root.Path, hash)
+				if err != nil {
+					m.logger.Warn("failed to read commit",
+						slog.String("root", root.Path),
+						slog.String("commit", hash),
+						slog.String("error", err.Error()))
+					continue
+				}
+				if n := m.sanitizeCommit(c); n > 0 {
+					m.logger.Info("redacted secrets",
+						slog.String("commit", hash),
+						slog.Int("count", n))
+				}
+				doc := commitDocument(root.Alias, c)
+				if err := batch.Index(doc.ID, doc); err != nil {
+					m.logger.Warn("failed to index commit",
+						slog.String("commit", hash),
+						slog.String("error", err.Error()))
+					continue
+				}
+				added++
+			}
+			mf.Commits[root.Alias] = append(mf.Commits[root.Alias], hash)
+		}
+	}
+
+	removed := 0
+	for repo, hashes := range indexed {
+		current := make(map[string]bool, len(mf.Commits[repo]))
+		for _, hash := range mf.Commits[repo] {
+			current[hash] = true
+		}
+		for _, hash := range hashes {
+			if !current[hash] {
+				batch.Delete(commitID(repo, hash))
+				removed++
+			}
+		}
+	}
+	return added, removed
+}
+
+// HistoryOptions narrows down search of indexed commits.
+type HistoryOptions struct {
+	Repo   string // alias of indexed root, empty for all
+	Path   string // glob or directory prefix of touched paths
+	Author string
+	Limit  int // 0 = default limit
+}
+
+// CommitResult is an indexed commit matching history search.
+type CommitResult struct {
+	Repo    string    `json:"repo,omitempty"`
+	Commit  string    `json:"commit"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Summary string    `json:"summary"` // first line of commit message
+	Files   []string  `json:"files,omitempty"`
+	Score   float64   `json:"score"`
+}
+
+// HistoryResponse holds commits matching history search.
+type HistoryResponse struct {
+	Commits []CommitResult `json:"commits"`
+	Total   uint64         `json:"total"`
+}
+
+const defaultHistoryLimit = 10
+
+// SearchHistory searches messages and diffs of indexed commits.
+// Commits matching empty query are ordered from newest to oldest.
+func (s *searcher) SearchHistory(ctx context.Context, queryStr string, opts HistoryOptions) (*HistoryResponse, error) {
+	index, err := s.indexManager.GetIndex()
+	if err != nil {
+		return nil, fmt.Errorf("getting index: %w", err)
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	conjuncts := []query.Query{fieldTermQuery("kind", kindCommit)}
+	if strings.TrimSpace(queryStr) != "" {
+		textQuery, err := bleve.NewQueryStringQuery(queryStr).Parse()
+		if err != nil {
+			return nil, &QueryError{Reason: syntaxErrorReason(err)}
+		}
+		conjuncts = append(conjuncts, textQuery)
+	}
+	if opts.Repo != "" {
+		conjuncts = append(conjuncts, fieldTermQuery("repo", opts.Repo))
+	}
+	if opts.Path != "" {
+		pathQuery, err := globQuery("files", opts.Path)
+		if err != nil {
+			return nil, err
+		}
+		conjuncts = append(conjuncts, pathQuery)
+	}
+	if opts.Author != "" {
+		authorQuery := bleve.NewMatchQuery(opts.Author)
+		authorQuery.SetField("author")
+		authorQuery.SetOperator(query.MatchQueryOperatorAnd)
+		conjuncts = append(conjuncts, authorQuery)
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(conjuncts...), limit, 0, false)
+	if strings.TrimSpace(queryStr) == "" {
+		searchRequest.SortBy([]string{"-date", "_id"})
+	} else {
+		searchRequest.SortBy([]string{"-_score", "-date", "_id"})
+	}
+	searchRequest.Fields = []string{"repo", "commit", "author", "date", "message", "files"}
+
+	result, err := index.SearchInContext(ctx, searchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("search error: %w", err)
+	}
+
+	response := &HistoryResponse{
+		Commits: make([]CommitResult, 0, len(result.Hits)),
+		Total:   result.Total,
+	}
+	for _, hit := range result.Hits {
+		cr := CommitResult{Score: hit.Score}
+		if repoField, ok := hit.Fields["repo"].(string); ok {
+			cr.Repo = repoField
+		}
+		if commitField, ok := hit.Fields["commit"].(string); ok {
+			cr.Commit = commitField
+		}
+		if authorField, ok := hit.Fields["author"].(string); ok {
+			cr.Author = authorField
+		}
+		if dateField, ok := hit.Fields["date"].(string); ok {
+			cr.Date, _ = time.Parse(time.RFC3339, dateField)
+		}
+		if messageField, ok := hit.Fields["message"].(string); ok {
+			cr.Summary = firstLine(messageField)
+		}
+		cr.Files = storedStrings(hit.Fields["files"])
+		response.Commits = append(response.Commits, cr)
+	}
+	return response, nil
+}
+
+// storedStrings returns values of a stored field, which is a plain string if it has single value.
+func storedStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
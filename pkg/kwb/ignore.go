@@ -0,0 +1,245 @@
+package kwb
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	gitignoreFile = ".gitignore"
+	kwbignoreFile = ".kwbignore"
+)
+
+// gitExcludeFile holds repository-wide patterns which are not committed.
+var gitExcludeFile = filepath.Join(".git", "info", "exclude")
+
+// ignorePattern is a single parsed line of an ignore file.
+type ignorePattern struct {
+	base     string   // slash-separated directory pattern is relative to, "" for root
+	segments []string // pattern split by "/", may contain "**"
+	negate   bool
+	dirOnly  bool
+}
+
+// parseIgnorePattern parses a line using gitignore syntax.
+// Returns false for blank lines and comments.
+func parseIgnorePattern(base, line string) (ignorePattern, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	p := ignorePattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignorePattern{}, false
+	}
+
+	// Pattern without a slash matches at any depth, otherwise
+	// it is relative to the directory of the ignore file.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	p.segments = strings.Split(line, "/")
+	if !anchored {
+		p.segments = append([]string{"**"}, p.segments...)
+	}
+
+	return p, true
+}
+
+// match reports whether slash-separated path relative to root matches the pattern.
+func (p ignorePattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = rel[len(p.base)+1:]
+	}
+	return matchSegments(p.segments, strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			// Trailing "**" matches everything inside, but not the directory itself
+			if len(rest) == 0 {
+				return len(segments) > 0
+			}
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(rest, segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// ignoreRules decides which paths under root are ignored.
+// Ignore files are read lazily per directory and cached.
+type ignoreRules struct {
+	root         string
+	useGitignore bool
+	user         []ignorePattern
+
+	mu    sync.Mutex
+	cache map[string][]ignorePattern
+}
+
+// newIgnoreRules creates rules for root, excludeDirs are patterns which only match directories.
+func newIgnoreRules(root string, excludeDirs []string, useGitignore bool) *ignoreRules {
+	r := &ignoreRules{
+		root:         root,
+		useGitignore: useGitignore,
+		cache:        make(map[string][]ignorePattern),
+	}
+	for _, line := range excludeDirs {
+		if p, ok := parseIgnorePattern("", line); ok {
+			p.dirOnly = true
+			r.user = append(r.user, p)
+		}
+	}
+	return r
+}
+
+// Ignored reports whether path is excluded by user patterns or ignore files.
+// Parent directories are not checked, callers are expected to skip them first.
+func (r *ignoreRules) Ignored(path string, isDir bool) bool {
+	rel, err := filepath.Rel(r.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	for _, p := range r.user {
+		if p.match(rel, isDir) {
+			return true
+		}
+	}
+
+	// Patterns of deeper directories take precedence, last match wins
+	ignored := false
+	dirs := append([]string{""}, parentDirs(rel)...)
+	for _, dir := range dirs {
+		for _, p := range r.patterns(dir) {
+			if p.match(rel, isDir) {
+				ignored = !p.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// Invalidate drops cached patterns of a directory after its ignore files changed.
+func (r *ignoreRules) Invalidate(dir string) {
+	rel, err := filepath.Rel(r.root, dir)
+	if err != nil {
+		return
+	}
+	if rel == "." {
+		rel = ""
+	}
+	r.mu.Lock()
+	delete(r.cache, filepath.ToSlash(rel))
+	r.mu.Unlock()
+}
+
+// Reset drops all cached patterns.
+func (r *ignoreRules) Reset() {
+	r.mu.Lock()
+	clear(r.cache)
+	r.mu.Unlock()
+}
+
+func (r *ignoreRules) patterns(dir string) []ignorePattern {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if patterns, ok := r.cache[dir]; ok {
+		return patterns
+	}
+
+	var files []string
+	if r.useGitignore {
+		if dir == "" {
+			files = append(files, gitExcludeFile)
+		}
+		files = append(files, gitignoreFile)
+	}
+	files = append(files, kwbignoreFile)
+
+	var patterns []ignorePattern
+	for _, name := range files {
+		patterns = append(patterns, readIgnoreFile(filepath.Join(r.root, filepath.FromSlash(dir), name), dir)...)
+	}
+
+	r.cache[dir] = patterns
+	return patterns
+}
+
+func readIgnoreFile(filePath string, base string) []ignorePattern {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close() // nolint:errcheck
+
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if p, ok := parseIgnorePattern(base, scanner.Text()); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// parentDirs returns every parent directory of slash-separated rel, outermost first.
+func parentDirs(rel string) []string {
+	var dirs []string
+	for i := 0; i < len(rel); i++ {
+		if rel[i] == '/' {
+			dirs = append(dirs, rel[:i])
+		}
+	}
+	return dirs
+}
+
+// ignoreFileDir reports whether path under root is an ignore file,
+// and returns directory whose patterns it defines.
+func ignoreFileDir(root, path string) (string, bool) {
+	if rel, err := filepath.Rel(root, path); err == nil && rel == gitExcludeFile {
+		return root, true
+	}
+	name := filepath.Base(path)
+	if name == gitignoreFile || name == kwbignoreFile {
+		return filepath.Dir(path), true
+	}
+	return "", false
+}
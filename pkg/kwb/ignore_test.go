@@ -0,0 +1,120 @@
+package kwb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnorePattern_Match(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		pattern string
+		rel     string
+		isDir   bool
+		want    bool
+	}{
+		{name: "name at any depth", pattern: "*.log", rel: "a/b/debug.log", want: true},
+		{name: "name not matching", pattern: "*.log", rel: "a/b/debug.txt", want: false},
+		{name: "anchored", pattern: "/build", rel: "build", isDir: true, want: true},
+		{name: "anchored not nested", pattern: "/build", rel: "a/build", isDir: true, want: false},
+		{name: "path with slash", pattern: "internal/gen", rel: "internal/gen", isDir: true, want: true},
+		{name: "double star", pattern: "docs/**/*.md", rel: "docs/a/b/x.md", want: true},
+		{name: "trailing double star", pattern: "out/**", rel: "out/x.go", want: true},
+		{name: "trailing double star not dir itself", pattern: "out/**", rel: "out", isDir: true, want: false},
+		{name: "dir only on dir", pattern: "tmp/", rel: "a/tmp", isDir: true, want: true},
+		{name: "dir only on file", pattern: "tmp/", rel: "a/tmp", want: false},
+		{name: "relative to base", base: "sub", pattern: "/gen", rel: "sub/gen", isDir: true, want: true},
+		{name: "outside of base", base: "sub", pattern: "gen", rel: "other/gen", isDir: true, want: false},
+		{name: "escaped hash", pattern: `\#notes`, rel: "#notes", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := parseIgnorePattern(tt.base, tt.pattern)
+			if !ok {
+				t.Fatalf("parseIgnorePattern(%q) not ok", tt.pattern)
+			}
+			if got := p.match(tt.rel, tt.isDir); got != tt.want {
+				t.Errorf("match(%q, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIgnorePattern_Skipped(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment", "/"} {
+		if _, ok := parseIgnorePattern("", line); ok {
+			t.Errorf("parseIgnorePattern(%q) ok, want skipped", line)
+		}
+	}
+}
+
+func TestIgnoreRules_Ignored(t *testing.T) {
+	root := t.TempDir()
+	for path, content := range map[string]string{
+		".gitignore":        "*.log\n!keep.log\n",
+		".git/info/exclude": "secret/\n",
+		"sub/.kwbignore":    "*.tmp\n",
+	} {
+		path = filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		rel          string
+		isDir        bool
+		excludeDirs  []string
+		useGitignore bool
+		want         bool
+	}{
+		{name: "gitignore", rel: "debug.log", useGitignore: true, want: true},
+		{name: "gitignore negation", rel: "keep.log", useGitignore: true, want: false},
+		{name: "gitignore disabled", rel: "debug.log", want: false},
+		{name: "git exclude file", rel: "secret", isDir: true, useGitignore: true, want: true},
+		{name: "kwbignore in subdirectory", rel: "sub/x.tmp", want: true},
+		{name: "kwbignore not above its directory", rel: "x.tmp", want: false},
+		{name: "exclude dir", rel: "gen", isDir: true, excludeDirs: []string{"gen"}, want: true},
+		{name: "exclude dir does not match file", rel: "gen", excludeDirs: []string{"gen"}, want: false},
+		{name: "exclude dir pattern", rel: "a/gen", isDir: true, excludeDirs: []string{"a/*"}, want: true},
+		{name: "exclude dir pattern file", rel: "a/gen.go", excludeDirs: []string{"a/*"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := newIgnoreRules(root, tt.excludeDirs, tt.useGitignore)
+			path := filepath.Join(root, filepath.FromSlash(tt.rel))
+			if got := rules.Ignored(path, tt.isDir); got != tt.want {
+				t.Errorf("Ignored(%s, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreFileDir(t *testing.T) {
+	root := "repo"
+	tests := []struct {
+		path    string
+		wantDir string
+		want    bool
+	}{
+		{path: filepath.Join(root, ".gitignore"), wantDir: root, want: true},
+		{path: filepath.Join(root, "sub", ".kwbignore"), wantDir: filepath.Join(root, "sub"), want: true},
+		{path: filepath.Join(root, ".git", "info", "exclude"), wantDir: root, want: true},
+		{path: filepath.Join(root, "sub", ".git", "info", "exclude"), want: false},
+		{path: filepath.Join(root, "main.go"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			dir, ok := ignoreFileDir(root, tt.path)
+			if dir != tt.wantDir || ok != tt.want {
+				t.Errorf("ignoreFileDir() = %q, %v, want %q, %v", dir, ok, tt.wantDir, tt.want)
+			}
+		})
+	}
+}
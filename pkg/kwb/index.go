@@ -1,10 +1,15 @@
 package kwb
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/blevesearch/bleve/v2"
 	"github.com/blevesearch/bleve/v2/mapping"
@@ -46,46 +51,116 @@ var allowedExtensions = []string{
 type indexManager struct {
 	logger   *slog.Logger
 	settings *Settings
-	index    bleve.Index
+	version  string   // go42x version recorded in the manifest
+	embedder Embedder // nil if embeddings are disabled
+
+	indexMu   sync.Mutex
+	index     bleve.Index
+	indexInfo os.FileInfo // directory of opened index generation
+	indexLock *os.File    // shared lock of opened generation, nil if it could not be taken
+
+	ignoreMu sync.Mutex
+	ignore   map[string]*ignoreRules // per root path
+
+	listenersMu sync.Mutex
+	listeners   []func(IndexChange)
 }
 
-func newIndexManager(settings *Settings, logger *slog.Logger) *indexManager {
+// IndexChange lists files whose documents were changed by an index update.
+type IndexChange struct {
+	Added   []string
+	Updated []string
+	Removed []string
+}
+
+func (c IndexChange) empty() bool {
+	return len(c.Added) == 0 && len(c.Updated) == 0 && len(c.Removed) == 0
+}
+
+func newIndexManager(settings *Settings, version string, embedder Embedder, logger *slog.Logger) *indexManager {
 	return &indexManager{
 		logger:   logger,
 		settings: settings,
+		version:  version,
+		embedder: embedder,
+		ignore:   make(map[string]*ignoreRules),
 	}
 }
 
-func (m *indexManager) BuildIndex(rootPath string) error {
-	// Remove old index if exists
-	err := os.RemoveAll(m.settings.IndexPath)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("removing old index: %w", err)
+// BuildIndex builds new generation of the index and publishes it once complete.
+// Other writers of the index wait until it is published.
+func (m *indexManager) BuildIndex(roots []Root) error {
+	lock, err := lockWrites(m.settings.IndexPath)
+	if err != nil {
+		return err
 	}
+	defer lock.Close() // nolint:errcheck
 
-	// Create directory for index
-	indexDir := filepath.Dir(m.settings.IndexPath)
-	if err := os.MkdirAll(indexDir, 0755); err != nil {
-		return fmt.Errorf("creating index directory: %w", err)
+	dir, err := newGeneration(m.settings.IndexPath)
+	if err != nil {
+		return err
 	}
 
-	// Create optimized index mapping
-	mapping := m.createOptimizedMapping()
+	index, mf, err := m.prepareIndex(dir)
+	if err == nil {
+		err = m.syncIndex(index, mf, roots)
+		if closeErr := index.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("closing index: %w", closeErr)
+		}
+	}
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return err
+	}
 
-	// Use configured index type (scorch is faster and more memory efficient)
-	indexType := m.settings.IndexType
-	if indexType == "" {
-		indexType = "scorch"
+	return publishGeneration(m.settings.IndexPath, dir)
+}
+
+// SyncIndex brings already opened index up to date with the file trees of roots.
+// Nil roots stand for roots and indexing options recorded by the last build, which are
+// then applied to settings. Otherwise roots and settings must match the recorded ones,
+// so syncing never drops documents of roots, dependencies or commits the index was built with.
+// Returns synced roots.
+func (m *indexManager) SyncIndex(roots []Root) ([]Root, error) {
+	lock, err := lockWrites(m.settings.IndexPath)
+	if err != nil {
+		return nil, err
 	}
+	defer lock.Close() // nolint:errcheck
 
-	index, err := bleve.NewUsing(m.settings.IndexPath, mapping, indexType, indexType, nil)
+	index, err := m.GetIndex()
 	if err != nil {
-		return fmt.Errorf("creating index: %w", err)
+		return nil, err
+	}
+
+	mf, err := m.loadManifest(index)
+	if err != nil {
+		return nil, err
+	}
+
+	if roots == nil {
+		roots = mf.indexedRoots()
+		if len(roots) == 0 {
+			return nil, fmt.Errorf("index has no recorded roots, rebuild it with --full")
+		}
+		mf.Options.apply(m.settings)
+	} else if !mf.sameRoots(roots) || !mf.Options.equal(newOptionsRecord(m.settings)) {
+		return nil, fmt.Errorf("index was built with different roots or indexing options, " +
+			"run 'kwb build' to change them or omit them to use the recorded ones")
+	}
+
+	return roots, m.syncIndex(index, mf, roots)
+}
+
+func (m *indexManager) syncIndex(index bleve.Index, mf *manifest, roots []Root) error {
+	if m.settings.IndexDeps {
+		roots = append(roots[:len(roots):len(roots)], m.dependencyRoots(roots)...)
 	}
-	defer index.Close() // nolint:errcheck
 
 	// Walk and index files with batch processing
-	fileCount := 0
+	var change IndexChange
+	unchanged := 0
+	seen := make(map[string]bool)
 	batch := index.NewBatch()
 	batchSize := 0
 	maxBatchSize := m.settings.BatchSize
@@ -93,138 +168,744 @@ func (m *indexManager) BuildIndex(rootPath string) error {
 		maxBatchSize = 100
 	}
 
-	err = filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			m.logger.Error("error accessing path", "err", err, "path", path)
-			return nil
-		}
+	for _, root := range roots {
+		// Ignore files could have changed since previous walk
+		m.ignoreRules(root.Path).Reset()
 
-		// Skip directories
-		if info.IsDir() {
-			// Check if directory should be excluded
-			dirName := filepath.Base(path)
-			for _, excl := range defaultExcludedDirs {
-				if dirName == excl {
-					m.logger.Info("skipping excluded directory", slog.String("path", path))
-					return filepath.SkipDir
-				}
+		err := m.walk(root.Path, func(path string, info os.FileInfo) error {
+			rel, err := root.relPath(path)
+			if err != nil {
+				return err
+			}
+			if root.module != "" && !isDependencySource(rel) {
+				return nil
+			}
+			id := fileID(root.Alias, rel)
+			seen[id] = true
+
+			_, exists := mf.Files[id]
+			changed, err := m.indexFile(batch, mf, root, rel, path, info)
+			if err != nil {
+				m.logger.Error("failed to add document to batch",
+					slog.String("path", path),
+					slog.String("error", err.Error()))
+				return nil
 			}
-			for _, excl := range m.settings.ExcludeDirs {
-				if dirName == excl {
-					m.logger.Info("skipping user-excluded directory", slog.String("path", path))
-					return filepath.SkipDir
+			if !changed {
+				unchanged++
+				return nil
+			}
+			batchSize++
+
+			if exists {
+				change.Updated = append(change.Updated, id)
+			} else {
+				change.Added = append(change.Added, id)
+			}
+
+			// Process batch when it reaches max size
+			if batchSize >= maxBatchSize {
+				if err := index.Batch(batch); err != nil {
+					m.logger.Error("failed to process batch",
+						slog.String("error", err.Error()))
+					return fmt.Errorf("batch indexing failed: %w", err)
 				}
+				m.logger.Info("processed batch", slog.Int("size", batchSize))
+				batch = index.NewBatch()
+				batchSize = 0
 			}
+
+			m.logger.Debug("queued file for indexing", slog.String("path", path))
 			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("walking directory %s: %w", root.Path, err)
 		}
+	}
 
-		// Check if file should be indexed
-		ext := filepath.Ext(path)
-		if !m.shouldIndexFile(m.settings.ExtraExtensions, info.Name(), ext) {
-			return nil
+	// Delete documents of files which no longer exist or are excluded now
+	for id := range mf.Files {
+		if seen[id] {
+			continue
 		}
+		m.removeFile(batch, mf, id)
+		batchSize++
+		change.Removed = append(change.Removed, id)
+		m.logger.Debug("queued file for removal", slog.String("id", id))
+	}
 
-		// Skip very large files
-		if info.Size() > int64(m.settings.MaxFileSize) {
-			m.logger.Warn("skipping large file",
-				slog.String("path", path),
-				slog.Int64("size", info.Size()))
-			return nil
+	commitsAdded, commitsRemoved := m.syncHistory(batch, mf, roots)
+	batchSize += commitsAdded + commitsRemoved
+	if commitsAdded > 0 || commitsRemoved > 0 {
+		m.logger.Info("synced git history",
+			slog.Int("added", commitsAdded),
+			slog.Int("removed", commitsRemoved))
+	}
+
+	// Process remaining documents together with manifest
+	if err := mf.recordBuild(roots, m.settings, m.version); err != nil {
+		return err
+	}
+	if err := mf.save(batch); err != nil {
+		return err
+	}
+	if err := index.Batch(batch); err != nil {
+		return fmt.Errorf("final batch indexing failed: %w", err)
+	}
+	m.logger.Info("processed final batch", slog.Int("size", batchSize))
+
+	count, _ := index.DocCount()
+	m.logger.Info("indexing complete",
+		slog.Uint64("documents", count),
+		slog.Int("added", len(change.Added)),
+		slog.Int("updated", len(change.Updated)),
+		slog.Int("unchanged", unchanged),
+		slog.Int("removed", len(change.Removed)))
+
+	m.notify(change)
+
+	return nil
+}
+
+// UpdateFiles re-indexes given paths under roots in opened index.
+// Paths which no longer exist, or should not be indexed, are removed from index.
+// Removed directory paths drop every indexed file beneath them.
+func (m *indexManager) UpdateFiles(roots []Root, paths []string) error {
+	lock, err := lockWrites(m.settings.IndexPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Close() // nolint:errcheck
+
+	index, err := m.GetIndex()
+	if err != nil {
+		return err
+	}
+
+	mf, err := m.loadManifest(index)
+	if err != nil {
+		return err
+	}
+
+	var change IndexChange
+	batch := index.NewBatch()
+	for _, path := range paths {
+		root, ok := rootOf(roots, path)
+		if !ok {
+			m.logger.Warn("file is outside of indexed roots", slog.String("path", path))
+			continue
+		}
+		rel, err := root.relPath(path)
+		if err != nil {
+			continue
+		}
+		id := fileID(root.Alias, rel)
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				m.logger.Warn("failed to stat file",
+					slog.String("path", path),
+					slog.String("error", err.Error()))
+				continue
+			}
+			prefix := id + "/"
+			if rel == "." {
+				prefix = fileID(root.Alias, "")
+			}
+			for indexed := range mf.Files {
+				if indexed == id || strings.HasPrefix(indexed, prefix) {
+					m.removeFile(batch, mf, indexed)
+					change.Removed = append(change.Removed, indexed)
+					m.logger.Info("removed file from index", slog.String("id", indexed))
+				}
+			}
+			continue
+		}
+		if info.IsDir() {
+			continue
 		}
 
-		// Read and index file
-		content, err := os.ReadFile(path)
+		info, ok = m.resolveFile(root.Path, path, info)
+		if !ok || m.isExcludedPath(root.Path, path) || m.ignoreRules(root.Path).Ignored(path, false) ||
+			!m.isIndexable(path, info) {
+			if _, ok := mf.Files[id]; ok {
+				m.removeFile(batch, mf, id)
+				change.Removed = append(change.Removed, id)
+				m.logger.Info("removed file from index", slog.String("id", id))
+			}
+			continue
+		}
+
+		_, exists := mf.Files[id]
+		changed, err := m.indexFile(batch, mf, root, rel, path, info)
 		if err != nil {
-			m.logger.Warn("failed to read file",
+			m.logger.Error("failed to add document to batch",
 				slog.String("path", path),
 				slog.String("error", err.Error()))
-			return nil
+			continue
+		}
+		if !changed {
+			continue
+		}
+		m.logger.Info("re-indexed file", slog.String("path", path))
+		if exists {
+			change.Updated = append(change.Updated, id)
+		} else {
+			change.Added = append(change.Added, id)
 		}
+	}
+
+	if batch.Size() == 0 {
+		return nil
+	}
+	if err := mf.save(batch); err != nil {
+		return err
+	}
+	if err := index.Batch(batch); err != nil {
+		return fmt.Errorf("batch indexing failed: %w", err)
+	}
+
+	m.notify(change)
+
+	return nil
+}
+
+// onChange registers fn to be called after index updates which changed any file.
+func (m *indexManager) onChange(fn func(IndexChange)) {
+	m.listenersMu.Lock()
+	defer m.listenersMu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+func (m *indexManager) notify(change IndexChange) {
+	if change.empty() {
+		return
+	}
+	m.listenersMu.Lock()
+	listeners := m.listeners
+	m.listenersMu.Unlock()
+	for _, fn := range listeners {
+		fn(change)
+	}
+}
+
+// indexFile queues file at path for indexing unless its content matches the manifest.
+// Path of the file relative to root is given by rel.
+// Reports whether file was queued.
+func (m *indexManager) indexFile(
+	batch *bleve.Batch,
+	mf *manifest,
+	root Root,
+	rel, path string,
+	info os.FileInfo,
+) (bool, error) {
+	id := fileID(root.Alias, rel)
 
-		doc := document{
-			ID:      path,
-			Path:    path,
-			Content: string(content),
-			Type:    getFileType(path),
+	// Skip files which were not touched since last build
+	if mf.unchanged(id, info) && !mf.racy(id) {
+		return false, nil
+	}
+
+	// Read and index file
+	indexed := time.Now()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("reading file: %w", err)
+	}
+
+	entry := manifestEntry{
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+		Hash:    hashContent(content),
+		Indexed: indexed,
+	}
+
+	// File was touched, but content is the same
+	if prev, ok := mf.Files[id]; ok && prev.Hash == entry.Hash {
+		entry.Documents = prev.Documents
+		entry.Redactions = prev.Redactions
+		mf.Files[id] = entry
+		return false, nil
+	}
+
+	// Secrets must never reach the index
+	content, entry.Redactions = redactSecrets(content)
+	if entry.Redactions > 0 {
+		m.logger.Info("redacted secrets",
+			slog.String("path", path),
+			slog.Int("count", entry.Redactions))
+	}
+
+	docs := m.buildDocuments(root, rel, content)
+	if m.embedder != nil {
+		vectors, err := embedDocuments(context.Background(), m.embedder, docs)
+		if err != nil {
+			return false, fmt.Errorf("embedding documents: %w", err)
+		}
+		if vectors != nil {
+			batch.SetInternal(vectorKey(id), vectors)
+		} else {
+			batch.DeleteInternal(vectorKey(id))
+		}
+	}
+
+	ids := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		if err := batch.Index(doc.ID, doc); err != nil {
+			return false, err
+		}
+		ids[doc.ID] = true
+		if doc.ID != id {
+			entry.Documents = append(entry.Documents, doc.ID)
+		}
+	}
+
+	// Drop documents which were produced by previous version of the file
+	if prev, ok := mf.Files[id]; ok {
+		for _, id := range prev.Documents {
+			if !ids[id] {
+				batch.Delete(id)
+			}
 		}
+	}
+
+	mf.Files[id] = entry
+
+	return true, nil
+}
+
+// symbolParsers extract declarations of files as symbol documents, by file extension.
+var symbolParsers = map[string]func(path string, content []byte) ([]document, error){
+	".go":    parseGoSymbols,
+	".proto": parseProtoSymbols,
+	".sql":   parseSQLSymbols,
+}
 
-		// Add to batch
-		err = batch.Index(doc.ID, doc)
+// buildDocuments splits content of a file into documents, path is relative to root.
+// File document always comes first and uses file id as id.
+// Large files are split into overlapping chunks, in which case
+// file document carries no content of its own.
+func (m *indexManager) buildDocuments(root Root, path string, content []byte) []document {
+	lines := splitLines(string(content))
+	fileDoc := document{
+		ID:        path,
+		Path:      path,
+		Content:   string(content),
+		Type:      getFileType(path),
+		Kind:      kindFile,
+		StartLine: 1,
+		EndLine:   len(lines),
+	}
+
+	// Markdown is split by headings instead of fixed windows
+	var chunks []chunk
+	var sections []document
+	if filepath.Ext(path) == ".md" {
+		sections = sectionDocuments(path, lines, m.settings.ChunkLines, m.settings.ChunkOverlap)
+	}
+	if sections == nil {
+		chunks = splitChunks(lines, m.settings.ChunkLines, m.settings.ChunkOverlap)
+	}
+	if len(chunks) > 0 || len(sections) > 0 {
+		fileDoc.Content = ""
+	}
+
+	docs := []document{fileDoc}
+	for _, s := range sections {
+		s.Type = fileDoc.Type
+		docs = append(docs, s)
+	}
+	for _, c := range chunks {
+		docs = append(docs, document{
+			ID:        chunkID(path, c),
+			Path:      path,
+			Content:   c.Content,
+			Type:      fileDoc.Type,
+			Kind:      kindChunk,
+			StartLine: c.StartLine,
+			EndLine:   c.EndLine,
+		})
+	}
+
+	if parse, ok := symbolParsers[filepath.Ext(path)]; ok {
+		symbols, err := parse(path, content)
 		if err != nil {
-			m.logger.Error("failed to add document to batch",
+			m.logger.Debug("failed to extract symbols",
 				slog.String("path", path),
 				slog.String("error", err.Error()))
+		}
+		docs = append(docs, symbols...)
+	}
+
+	// Fields shared by every document of the file,
+	// ids are namespaced so that same paths of different repos do not collide
+	ext := strings.ToLower(filepath.Ext(path))
+	dir := topLevelDir(path)
+	for i := range docs {
+		docs[i].ID = fileID(root.Alias, docs[i].ID)
+		docs[i].Repo = root.Alias
+		docs[i].Ext = ext
+		docs[i].Dir = dir
+		if root.module != "" {
+			docs[i].Type = typeDependency
+			docs[i].Module = root.module
+			docs[i].ModuleVersion = root.version
+			docs[i].Dependency = true
+		}
+	}
+
+	return docs
+}
+
+// removeFile queues all documents of a file for deletion.
+func (m *indexManager) removeFile(batch *bleve.Batch, mf *manifest, id string) {
+	batch.Delete(id)
+	batch.DeleteInternal(vectorKey(id))
+	for _, docID := range mf.Files[id].Documents {
+		batch.Delete(docID)
+	}
+	delete(mf.Files, id)
+}
+
+// embedderName returns name of configured embedder, empty if embeddings are disabled.
+func (m *indexManager) embedderName() string {
+	if m.embedder == nil {
+		return ""
+	}
+	return m.embedder.Name()
+}
+
+// loadManifest loads manifest of opened index and ensures
+// it can be updated incrementally with current settings.
+func (m *indexManager) loadManifest(index bleve.Index) (*manifest, error) {
+	mf, err := loadManifest(index)
+	if err != nil {
+		return nil, err
+	}
+	if mf == nil || !mf.compatible(m.settings, m.embedderName()) {
+		return nil, fmt.Errorf("index is missing manifest or was built with different settings, rebuild it with --full")
+	}
+	return mf, nil
+}
+
+// prepareIndex copies existing index into dir for incremental update,
+// or creates a new one there if full rebuild is requested or required.
+func (m *indexManager) prepareIndex(dir string) (bleve.Index, *manifest, error) {
+	if m.settings.FullRebuild || !m.settings.IndexExists() {
+		return m.createIndex(dir)
+	}
+
+	if err := copyIndex(m.settings.IndexPath, dir); err != nil {
+		m.logger.Warn("failed to copy existing index, rebuilding",
+			slog.String("error", err.Error()))
+		return m.recreateIndex(dir)
+	}
+	index, err := bleve.Open(dir)
+	if err != nil {
+		m.logger.Warn("failed to open existing index, rebuilding",
+			slog.String("error", err.Error()))
+		return m.recreateIndex(dir)
+	}
+	mf, err := loadManifest(index)
+	if err != nil || mf == nil || !mf.compatible(m.settings, m.embedderName()) {
+		m.logger.Warn("index has no valid manifest or was built with different settings, rebuilding")
+		_ = index.Close()
+		return m.recreateIndex(dir)
+	}
+	m.logger.Info("updating existing index",
+		slog.Int("known_files", len(mf.Files)))
+	return index, mf, nil
+}
+
+// recreateIndex discards whatever was copied into dir and creates a new index there.
+func (m *indexManager) recreateIndex(dir string) (bleve.Index, *manifest, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, nil, fmt.Errorf("removing copied index: %w", err)
+	}
+	return m.createIndex(dir)
+}
+
+func (m *indexManager) createIndex(dir string) (bleve.Index, *manifest, error) {
+	// Create optimized index mapping
+	mapping, err := m.createOptimizedMapping()
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating mapping: %w", err)
+	}
+
+	// Use configured index type (scorch is faster and more memory efficient)
+	indexType := m.settings.IndexType
+	if indexType == "" {
+		indexType = "scorch"
+	}
+
+	index, err := bleve.NewUsing(dir, mapping, indexType, indexType, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating index: %w", err)
+	}
+
+	return index, newManifest(m.settings, m.embedderName()), nil
+}
+
+// walk traverses rootPath and calls fn for every file which should be indexed.
+func (m *indexManager) walk(rootPath string, fn func(path string, info os.FileInfo) error) error {
+	rules := m.ignoreRules(rootPath)
+	return filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			m.logger.Error("error accessing path", "err", err, "path", path)
 			return nil
 		}
-		batchSize++
 
-		// Process batch when it reaches max size
-		if batchSize >= maxBatchSize {
-			if err := index.Batch(batch); err != nil {
-				m.logger.Error("failed to process batch",
-					slog.String("error", err.Error()))
-				return fmt.Errorf("batch indexing failed: %w", err)
+		// Skip directories
+		if info.IsDir() {
+			if path != rootPath && m.isExcludedDir(rootPath, path) {
+				return filepath.SkipDir
 			}
-			m.logger.Info("processed batch", slog.Int("size", batchSize))
-			batch = index.NewBatch()
-			batchSize = 0
+			return nil
 		}
 
-		fileCount++
-		m.logger.Debug("queued file for indexing", slog.String("path", path))
-		return nil
-	})
+		if rules.Ignored(path, false) {
+			m.logger.Debug("skipping ignored file", slog.String("path", path))
+			return nil
+		}
 
-	// Process remaining documents in batch
-	if batchSize > 0 {
-		if err := index.Batch(batch); err != nil {
-			return fmt.Errorf("final batch indexing failed: %w", err)
+		info, ok := m.resolveFile(rootPath, path, info)
+		if !ok || !m.isIndexable(path, info) {
+			return nil
 		}
-		m.logger.Info("processed final batch", slog.Int("size", batchSize))
+
+		return fn(path, info)
+	})
+}
+
+// resolveFile returns info of a regular file to index, given its Lstat info.
+// Symlinks are followed only to regular files under the root, so they can not expose
+// files outside of it, and size limit applies to the target.
+func (m *indexManager) resolveFile(rootPath, path string, info os.FileInfo) (os.FileInfo, bool) {
+	if info.Mode()&os.ModeSymlink == 0 {
+		return info, info.Mode().IsRegular()
 	}
 
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		m.logger.Debug("skipping broken symlink", slog.String("path", path))
+		return nil, false
+	}
+	rootDir, err := filepath.EvalSymlinks(rootPath)
 	if err != nil {
-		return fmt.Errorf("walking directory: %w", err)
+		return nil, false
+	}
+	rootDir, errRoot := filepath.Abs(rootDir)
+	target, errTarget := filepath.Abs(target)
+	if errRoot != nil || errTarget != nil || !isWithinDir(rootDir, target) {
+		m.logger.Warn("skipping symlink pointing outside of root", slog.String("path", path))
+		return nil, false
 	}
 
-	count, _ := index.DocCount()
-	m.logger.Info("indexing complete",
-		slog.Uint64("documents", count),
-		slog.Int("files_processed", fileCount))
+	// Stat of the link keeps its name, which deny-list and extension rules apply to
+	targetInfo, err := os.Stat(path)
+	if err != nil || !targetInfo.Mode().IsRegular() {
+		return nil, false
+	}
+	return targetInfo, true
+}
 
-	return nil
+// ignoreRules returns ignore rules for given root, creating them on first use.
+func (m *indexManager) ignoreRules(rootPath string) *ignoreRules {
+	m.ignoreMu.Lock()
+	defer m.ignoreMu.Unlock()
+
+	rules, ok := m.ignore[rootPath]
+	if !ok {
+		rules = newIgnoreRules(rootPath, m.settings.ExcludeDirs, !m.settings.NoGitignore)
+		m.ignore[rootPath] = rules
+	}
+	return rules
+}
+
+// isExcludedDir reports whether directory should not be indexed nor watched.
+func (m *indexManager) isExcludedDir(rootPath string, path string) bool {
+	// Never index the index itself, nor any of its generations
+	if isGenerationDir(m.settings.IndexPath, path) {
+		m.logger.Debug("skipping index directory", slog.String("path", path))
+		return true
+	}
+
+	// Check if directory should be excluded
+	dirName := filepath.Base(path)
+	for _, excl := range defaultExcludedDirs {
+		if dirName == excl {
+			m.logger.Info("skipping excluded directory", slog.String("path", path))
+			return true
+		}
+	}
+	if m.ignoreRules(rootPath).Ignored(path, true) {
+		m.logger.Info("skipping ignored directory", slog.String("path", path))
+		return true
+	}
+	return false
+}
+
+// isExcludedPath reports whether any parent directory of a file under rootPath is excluded.
+func (m *indexManager) isExcludedPath(rootPath string, path string) bool {
+	root := filepath.Clean(rootPath)
+	for dir := filepath.Dir(path); dir != root; dir = filepath.Dir(dir) {
+		if dir == "." || dir == string(filepath.Separator) {
+			break
+		}
+		if m.isExcludedDir(rootPath, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIndexable reports whether file passes extension and size rules.
+func (m *indexManager) isIndexable(path string, info os.FileInfo) bool {
+	if m.isDeniedFile(info.Name()) {
+		return false
+	}
+
+	// Check if file should be indexed
+	ext := filepath.Ext(path)
+	if !m.shouldIndexFile(m.settings.ExtraExtensions, info.Name(), ext) {
+		return false
+	}
+
+	// Skip very large files
+	if info.Size() > int64(m.settings.MaxFileSize) {
+		m.logger.Warn("skipping large file",
+			slog.String("path", path),
+			slog.Int64("size", info.Size()))
+		return false
+	}
+
+	return true
 }
 
+// isDeniedFile reports whether file name matches default or configured deny-list.
+func (m *indexManager) isDeniedFile(name string) bool {
+	return isDeniedFile(defaultDenyFiles, name) || isDeniedFile(m.settings.DenyFiles, name)
+}
+
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// retiredIndexTTL is how long replaced index generation is kept open
+// for requests which are still using it.
+const retiredIndexTTL = time.Minute
+
 func (m *indexManager) OpenIndex() error {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+	return m.openIndex()
+}
+
+func (m *indexManager) openIndex() error {
 	if m.index != nil {
 		return nil // Already open
 	}
 
-	index, err := bleve.Open(m.settings.IndexPath)
+	// Resolve the link first, so it can not be replaced between stat and open
+	dir, err := filepath.EvalSymlinks(m.settings.IndexPath)
+	if err != nil {
+		return fmt.Errorf("opening index: %w", err)
+	}
+	info, err := os.Stat(dir)
 	if err != nil {
 		return fmt.Errorf("opening index: %w", err)
 	}
+	// Lock keeps builds from removing the generation while it is open
+	lock, err := lockFile(filepath.Join(dir, generationLockFile), syscall.LOCK_SH)
+	if err != nil {
+		m.logger.Warn("failed to lock index generation, it could be removed while open",
+			slog.String("error", err.Error()))
+	}
+	index, err := bleve.Open(dir)
+	if err != nil {
+		if lock != nil {
+			_ = lock.Close()
+		}
+		return fmt.Errorf("opening index: %w", err)
+	}
 
 	m.index = index
+	m.indexInfo = info
+	m.indexLock = lock
 	return nil
 }
 
+// closeIndex closes index and releases lock of its generation.
+func closeIndex(index bleve.Index, lock *os.File) error {
+	err := index.Close()
+	if lock != nil {
+		_ = lock.Close()
+	}
+	return err
+}
+
 func (m *indexManager) CloseIndex() error {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
 	if m.index != nil {
-		err := m.index.Close()
+		err := closeIndex(m.index, m.indexLock)
 		m.index = nil
+		m.indexLock = nil
 		return err
 	}
 	return nil
 }
 
+// GetIndex returns opened index, opening it if needed.
+// If a build has published new generation since the index was opened,
+// the new generation is opened instead and files it changed are announced to listeners.
 func (m *indexManager) GetIndex() (bleve.Index, error) {
+	index, change, err := m.getIndex()
+	m.notify(change)
+	return index, err
+}
+
+func (m *indexManager) getIndex() (bleve.Index, IndexChange, error) {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	var retired bleve.Index
+	if m.index != nil && m.replaced() {
+		m.logger.Info("index was rebuilt, reopening", slog.String("index_path", m.settings.IndexPath))
+		retired = m.index
+		retiredLock := m.indexLock
+		m.index = nil
+		m.indexLock = nil
+		time.AfterFunc(retiredIndexTTL, func() {
+			_ = closeIndex(retired, retiredLock)
+		})
+	}
+
 	if m.index == nil {
-		if err := m.OpenIndex(); err != nil {
-			return nil, err
+		if err := m.openIndex(); err != nil {
+			return nil, IndexChange{}, err
 		}
 	}
-	return m.index, nil
+
+	var change IndexChange
+	if retired != nil {
+		change = generationChange(retired, m.index)
+	}
+	return m.index, change, nil
+}
+
+// replaced reports whether index path points to other generation than the opened one.
+// Missing index path is not considered a replacement.
+func (m *indexManager) replaced() bool {
+	info, err := os.Stat(m.settings.IndexPath)
+	if err != nil {
+		return false
+	}
+	return !os.SameFile(info, m.indexInfo)
 }
 
 func (m *indexManager) GetStats() (map[string]interface{}, error) {
@@ -243,14 +924,114 @@ func (m *indexManager) GetStats() (map[string]interface{}, error) {
 		"index_path":     m.settings.IndexPath,
 	}
 
+	mf, err := loadManifest(index)
+	if err != nil {
+		return nil, err
+	}
+	if mf == nil {
+		return stats, nil
+	}
+
+	redactions, redactedFiles := 0, 0
+	for _, entry := range mf.Files {
+		if entry.Redactions > 0 {
+			redactions += entry.Redactions
+			redactedFiles++
+		}
+	}
+	stats["redactions"] = redactions
+	stats["redacted_files"] = redactedFiles
+
+	stats["file_count"] = len(mf.Files)
+	stats["types"] = mf.Types
+	roots := make([]string, 0, len(mf.Roots))
+	deps := make([]string, 0)
+	heads := make(map[string]string, len(mf.Roots))
+	for _, root := range mf.Roots {
+		if root.Module != "" {
+			deps = append(deps, root.Alias)
+			continue
+		}
+		roots = append(roots, Root{Alias: root.Alias, Path: root.Dir}.String())
+		heads[root.Alias] = root.GitHead
+	}
+	stats["roots"] = roots
+	stats["dependencies"] = deps
+	stats["git_head"] = perRoot(heads)
+	stats["built_at"] = mf.BuiltAt
+	stats["updated_at"] = mf.UpdatedAt
+	stats["version"] = mf.ToolVersion
+	stats["settings"] = map[string]interface{}{
+		"analyzer":         mf.Analyzer,
+		"chunk_lines":      mf.ChunkLines,
+		"chunk_overlap":    mf.ChunkOverlap,
+		"index_type":       mf.Options.IndexType,
+		"max_file_size":    mf.Options.MaxFileSize,
+		"exclude_dirs":     mf.Options.ExcludeDirs,
+		"extra_extensions": mf.Options.ExtraExtensions,
+		"deny_files":       mf.Options.DenyFiles,
+		"no_gitignore":     mf.Options.NoGitignore,
+		"deps":             mf.Options.Deps,
+		"history":          mf.Options.History,
+		"embedder":         mf.Embedder,
+	}
+
+	// Drift: files changed on disk since they were indexed
+	modified, missing := 0, 0
+	for id := range mf.Files {
+		info, err := os.Stat(mf.filePath(id))
+		switch {
+		case err != nil:
+			missing++
+		case !mf.unchanged(id, info):
+			modified++
+		}
+	}
+	stats["modified_files"] = modified
+	stats["missing_files"] = missing
+	stale := modified > 0 || missing > 0
+	moved := make(map[string]string)
+	for _, root := range mf.Roots {
+		if root.GitHead == "" {
+			continue
+		}
+		if head := gitHead(root.Dir); head != root.GitHead {
+			moved[root.Alias] = head
+		}
+	}
+	if len(moved) > 0 {
+		stats["current_git_head"] = perRoot(moved)
+		stale = true
+	}
+	stats["stale"] = stale
+
 	return stats, nil
 }
 
-func (m *indexManager) createOptimizedMapping() mapping.IndexMapping {
+// perRoot returns value of the only unaliased root as is, values of several roots by alias.
+func perRoot(values map[string]string) interface{} {
+	if value, ok := values[""]; ok && len(values) == 1 {
+		return value
+	}
+	byAlias := make(map[string]interface{}, len(values))
+	for alias, value := range values {
+		byAlias[alias] = value
+	}
+	return byAlias
+}
+
+func (m *indexManager) createOptimizedMapping() (mapping.IndexMapping, error) {
 	mapping := bleve.NewIndexMapping()
 
-	// Configure default analyzer for better code search
-	mapping.DefaultAnalyzer = "standard"
+	// Register code analyzer, it splits identifiers into words
+	if err := addCodeAnalyzer(mapping); err != nil {
+		return nil, err
+	}
+	analyzer := analyzerName(m.settings.Analyzer)
+
+	// Configure default analyzer for better code search,
+	// it is also used for queries which are not scoped to a field
+	mapping.DefaultAnalyzer = analyzer
 
 	// Create document mapping
 	docMapping := bleve.NewDocumentMapping()
@@ -272,8 +1053,113 @@ func (m *indexManager) createOptimizedMapping() mapping.IndexMapping {
 	contentField.Store = true // Store content for retrieval
 	contentField.IncludeInAll = true
 	contentField.IncludeTermVectors = true // For highlighting
-	contentField.Analyzer = "standard"
-	docMapping.AddFieldMappingsAt("content", contentField)
+	contentField.Analyzer = analyzer
+	docMapping.AddFieldMappingsAt("content", contentField, newIdentifierFieldMapping())
+
+	// Ext field - keyword for filtering by file extension
+	extField := bleve.NewKeywordFieldMapping()
+	extField.Store = true
+	extField.IncludeInAll = false
+	docMapping.AddFieldMappingsAt("ext", extField)
+
+	// Dir field - keyword for faceting by top-level directory
+	dirField := bleve.NewKeywordFieldMapping()
+	dirField.Store = true
+	dirField.IncludeInAll = false
+	docMapping.AddFieldMappingsAt("dir", dirField)
+
+	// Repo field - keyword for filtering by alias of indexed root
+	repoField := bleve.NewKeywordFieldMapping()
+	repoField.Store = true
+	repoField.IncludeInAll = false
+	docMapping.AddFieldMappingsAt("repo", repoField)
+
+	// Module fields of dependency documents
+	for _, name := range []string{"module", "module_version"} {
+		field := bleve.NewKeywordFieldMapping()
+		field.Store = true
+		field.IncludeInAll = false
+		docMapping.AddFieldMappingsAt(name, field)
+	}
+
+	// Dependency flag, project documents are ranked above dependencies by it
+	dependencyField := bleve.NewBooleanFieldMapping()
+	dependencyField.Store = false
+	dependencyField.IncludeInAll = false
+	dependencyField.DocValues = true
+	docMapping.AddFieldMappingsAt("dependency", dependencyField)
+
+	// Kind field - keyword for filtering files, symbols etc.
+	kindField := bleve.NewKeywordFieldMapping()
+	kindField.Store = true
+	kindField.IncludeInAll = false
+	docMapping.AddFieldMappingsAt("kind", kindField)
+
+	// Declaration fields of symbol documents
+	for _, name := range []string{"package", "receiver", "symbol_kind"} {
+		field := bleve.NewKeywordFieldMapping()
+		field.Store = true
+		field.IncludeInAll = false
+		docMapping.AddFieldMappingsAt(name, field)
+	}
+
+	nameField := bleve.NewTextFieldMapping()
+	nameField.Store = true
+	nameField.IncludeInAll = true
+	nameField.Analyzer = analyzer
+	docMapping.AddFieldMappingsAt("name", nameField, newIdentifierFieldMapping())
+
+	signatureField := bleve.NewTextFieldMapping()
+	signatureField.Store = true
+	signatureField.IncludeInAll = true
+	signatureField.Analyzer = analyzer
+	docMapping.AddFieldMappingsAt("signature", signatureField)
+
+	// Doc comments are prose
+	docField := bleve.NewTextFieldMapping()
+	docField.Store = true
+	docField.IncludeInAll = true
+	docField.Analyzer = "standard"
+	docMapping.AddFieldMappingsAt("doc", docField)
+
+	exportedField := bleve.NewBooleanFieldMapping()
+	exportedField.Store = true
+	exportedField.IncludeInAll = false
+	docMapping.AddFieldMappingsAt("exported", exportedField)
+
+	// Commit fields of commit documents
+	for _, name := range []string{"commit", "date", "files"} {
+		field := bleve.NewKeywordFieldMapping()
+		field.Store = true
+		field.IncludeInAll = false
+		docMapping.AddFieldMappingsAt(name, field)
+	}
+	// Heading path of markdown sections is prose, anchor is matched exactly
+	sectionField := bleve.NewTextFieldMapping()
+	sectionField.Store = true
+	sectionField.IncludeInAll = true
+	sectionField.Analyzer = "standard"
+	docMapping.AddFieldMappingsAt("section", sectionField)
+
+	anchorField := bleve.NewKeywordFieldMapping()
+	anchorField.Store = true
+	anchorField.IncludeInAll = false
+	docMapping.AddFieldMappingsAt("anchor", anchorField)
+
+	for _, name := range []string{"author", "message"} {
+		field := bleve.NewTextFieldMapping()
+		field.Store = true
+		field.IncludeInAll = true
+		field.Analyzer = "standard"
+		docMapping.AddFieldMappingsAt(name, field)
+	}
+
+	for _, name := range []string{"start_line", "end_line"} {
+		field := bleve.NewNumericFieldMapping()
+		field.Store = true
+		field.IncludeInAll = false
+		docMapping.AddFieldMappingsAt(name, field)
+	}
 
 	// Set as default mapping
 	mapping.DefaultMapping = docMapping
@@ -282,7 +1168,7 @@ func (m *indexManager) createOptimizedMapping() mapping.IndexMapping {
 	mapping.IndexDynamic = false
 	mapping.StoreDynamic = false
 
-	return mapping
+	return mapping, nil
 }
 
 func (m *indexManager) shouldIndexFile(extra []string, name string, ext string) bool {
@@ -0,0 +1,230 @@
+package kwb
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSyncIndex_RecordedRootsAndOptions(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "gen"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"main.go":     "package main\n",
+		"gen/x.pb.go": "package gen\n",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	indexPath := filepath.Join(t.TempDir(), "kb.index")
+
+	newSettings := func() *Settings {
+		return &Settings{
+			IndexPath:   indexPath,
+			MaxFileSize: 1024 * 1024,
+			BatchSize:   100,
+			IndexType:   "scorch",
+		}
+	}
+	logger := slog.New(slog.DiscardHandler)
+
+	built := newSettings()
+	built.ExcludeDirs = []string{"gen"}
+	if err := newIndexManager(built, "test", nil, logger).BuildIndex([]Root{{Alias: "app", Path: root}}); err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+
+	t.Run("differing options", func(t *testing.T) {
+		m := newIndexManager(newSettings(), "test", nil, logger)
+		defer m.CloseIndex() // nolint:errcheck
+		if _, err := m.SyncIndex([]Root{{Alias: "app", Path: root}}); err == nil {
+			t.Error("SyncIndex() with options differing from the build succeeded")
+		}
+	})
+
+	t.Run("recorded", func(t *testing.T) {
+		settings := newSettings()
+		m := newIndexManager(settings, "test", nil, logger)
+		defer m.CloseIndex() // nolint:errcheck
+
+		roots, err := m.SyncIndex(nil)
+		if err != nil {
+			t.Fatalf("SyncIndex() error = %v", err)
+		}
+		if len(roots) != 1 || roots[0].Alias != "app" {
+			t.Errorf("SyncIndex() roots = %v, want root app", roots)
+		}
+		if len(settings.ExcludeDirs) != 1 || settings.ExcludeDirs[0] != "gen" {
+			t.Errorf("recorded options were not applied: %v", settings.ExcludeDirs)
+		}
+
+		index, err := m.GetIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mf, err := loadManifest(index)
+		if err != nil || mf == nil {
+			t.Fatalf("loadManifest() = %v, %v", mf, err)
+		}
+		if _, ok := mf.Files["app:main.go"]; !ok {
+			t.Errorf("app:main.go was dropped by sync, files: %v", mf.Files)
+		}
+		if _, ok := mf.Files["app:gen/x.pb.go"]; ok {
+			t.Error("app:gen/x.pb.go of excluded directory was indexed by sync")
+		}
+	})
+}
+
+func TestBuildIndex_Symlinks(t *testing.T) {
+	root := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "passwd.go")
+	for path, content := range map[string]string{
+		filepath.Join(root, "main.go"): "package main\n",
+		outside:                        "package secret\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("main.go", filepath.Join(root, "alias.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := &Settings{
+		IndexPath:   filepath.Join(t.TempDir(), "kb.index"),
+		MaxFileSize: 1024 * 1024,
+		BatchSize:   100,
+		IndexType:   "scorch",
+	}
+	m := newIndexManager(settings, "test", nil, slog.New(slog.DiscardHandler))
+	roots := []Root{{Path: root}}
+	if err := m.BuildIndex(roots); err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+	defer m.CloseIndex() // nolint:errcheck
+
+	// Watched updates must not follow the link either
+	if err := m.UpdateFiles(roots, []string{filepath.Join(root, "escape.go")}); err != nil {
+		t.Fatalf("UpdateFiles() error = %v", err)
+	}
+
+	index, err := m.GetIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf, err := loadManifest(index)
+	if err != nil || mf == nil {
+		t.Fatalf("loadManifest() = %v, %v", mf, err)
+	}
+	if _, ok := mf.Files["escape.go"]; ok {
+		t.Error("symlink pointing outside of root was indexed")
+	}
+	for _, id := range []string{"main.go", "alias.go"} {
+		if _, ok := mf.Files[id]; !ok {
+			t.Errorf("%s was not indexed, files: %v", id, mf.Files)
+		}
+	}
+}
+
+func TestBuildIndex_Incremental(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.go", "package a\n")
+	write("b.go", "package b\n")
+	write("c.go", "package c\n")
+
+	settings := &Settings{
+		IndexPath:   filepath.Join(t.TempDir(), "kb.index"),
+		MaxFileSize: 1024 * 1024,
+		BatchSize:   100,
+		IndexType:   "scorch",
+	}
+	logger := slog.New(slog.DiscardHandler)
+
+	// Every step is a separate build, the way kwb build is run
+	steps := []struct {
+		name   string
+		change func()
+		want   IndexChange
+	}{
+		{
+			name:   "initial",
+			change: func() {},
+			want:   IndexChange{Added: []string{"a.go", "b.go", "c.go"}},
+		},
+		{
+			name:   "modified",
+			change: func() { write("a.go", "package a\n\nfunc A() {}\n") },
+			want:   IndexChange{Updated: []string{"a.go"}},
+		},
+		{
+			name: "deleted",
+			change: func() {
+				if err := os.Remove(filepath.Join(root, "b.go")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: IndexChange{Removed: []string{"b.go"}},
+		},
+		{
+			name: "renamed",
+			change: func() {
+				if err := os.Rename(filepath.Join(root, "c.go"), filepath.Join(root, "d.go")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: IndexChange{Added: []string{"d.go"}, Removed: []string{"c.go"}},
+		},
+		{
+			// File systems with coarse timestamps keep modification time of quick edits
+			name: "same modification time and size",
+			change: func() {
+				path := filepath.Join(root, "d.go")
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				write("d.go", "package d\n")
+				if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: IndexChange{Updated: []string{"d.go"}},
+		},
+		{
+			name:   "unchanged",
+			change: func() {},
+			want:   IndexChange{},
+		},
+	}
+	for _, step := range steps {
+		step.change()
+
+		var got IndexChange
+		m := newIndexManager(settings, "test", nil, logger)
+		m.onChange(func(change IndexChange) {
+			got = change
+		})
+		if err := m.BuildIndex([]Root{{Path: root}}); err != nil {
+			t.Fatalf("%s: BuildIndex() error = %v", step.name, err)
+		}
+		slices.Sort(got.Added)
+		if !slices.Equal(got.Added, step.want.Added) ||
+			!slices.Equal(got.Updated, step.want.Updated) ||
+			!slices.Equal(got.Removed, step.want.Removed) {
+			t.Errorf("%s: change = %+v, want %+v", step.name, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package kwb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// manifestKey is the internal bleve key the manifest is stored under.
+var manifestKey = []byte("kwb_manifest")
+
+// manifestVersion must be increased whenever document layout or mapping changes,
+// indexes built with other version are rebuilt from scratch.
+const manifestVersion = 15
+
+// manifestEntry describes the state of a file at the time it was indexed.
+type manifestEntry struct {
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+	Hash    string    `json:"hash"`
+
+	// Indexed is when the file was read, zero for entries recorded by older versions
+	Indexed time.Time `json:"indexed"`
+
+	// Redactions is the number of secrets masked in the file
+	Redactions int `json:"redactions,omitempty"`
+
+	// Documents lists ids of documents produced from the file, besides the file itself
+	Documents []string `json:"documents,omitempty"`
+}
+
+// manifest tracks every indexed file, so subsequent builds can re-index
+// only what has changed since the previous run.
+type manifest struct {
+	Version      int                      `json:"version"`
+	Analyzer     string                   `json:"analyzer"`
+	ChunkLines   int                      `json:"chunk_lines"`
+	ChunkOverlap int                      `json:"chunk_overlap"`
+	Embedder     string                   `json:"embedder,omitempty"` // name of embedder, empty if disabled
+	Files        map[string]manifestEntry `json:"files"`
+
+	// Indexed roots, files are keyed by ids namespaced by root alias
+	Roots []manifestRoot `json:"roots,omitempty"`
+
+	// Hashes of indexed commits by root alias, newest first
+	Commits map[string][]string `json:"commits,omitempty"`
+
+	// Build metadata, recorded by every walk of the tree
+	BuiltAt     time.Time      `json:"built_at"`
+	UpdatedAt   time.Time      `json:"updated_at"` // last change of any kind, including watched updates
+	ToolVersion string         `json:"tool_version,omitempty"`
+	Options     optionsRecord  `json:"options"`
+	Types       map[string]int `json:"types,omitempty"` // number of files per type
+}
+
+// manifestRoot describes an indexed root at the time of the build.
+type manifestRoot struct {
+	Alias   string `json:"alias,omitempty"`
+	Path    string `json:"path"` // as given
+	Dir     string `json:"dir"`  // absolute
+	GitHead string `json:"git_head,omitempty"`
+
+	// Module path and version of dependency roots
+	Module  string `json:"module,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// optionsRecord holds settings which affect index contents, besides the ones
+// manifest keeps for compatibility checks.
+type optionsRecord struct {
+	IndexType       string   `json:"index_type"`
+	MaxFileSize     int      `json:"max_file_size"`
+	ExcludeDirs     []string `json:"exclude_dirs,omitempty"`
+	ExtraExtensions []string `json:"extra_extensions,omitempty"`
+	DenyFiles       []string `json:"deny_files,omitempty"`
+	NoGitignore     bool     `json:"no_gitignore,omitempty"`
+	Deps            bool     `json:"deps,omitempty"`
+	History         int      `json:"history,omitempty"`
+}
+
+func newManifest(settings *Settings, embedder string) *manifest {
+	return &manifest{
+		Version:      manifestVersion,
+		Analyzer:     settings.Analyzer,
+		ChunkLines:   settings.ChunkLines,
+		ChunkOverlap: settings.ChunkOverlap,
+		Embedder:     embedder,
+		Files:        make(map[string]manifestEntry),
+	}
+}
+
+// compatible reports whether index described by manifest can be updated
+// incrementally with given settings and embedder.
+func (mf *manifest) compatible(settings *Settings, embedder string) bool {
+	return mf.Version == manifestVersion &&
+		mf.Analyzer == settings.Analyzer &&
+		mf.ChunkLines == settings.ChunkLines &&
+		mf.ChunkOverlap == settings.ChunkOverlap &&
+		mf.Embedder == embedder
+}
+
+// loadManifest reads the manifest stored inside the index.
+// Returns nil manifest if index has none.
+func loadManifest(index bleve.Index) (*manifest, error) {
+	data, err := index.GetInternal(manifestKey)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	mf := &manifest{}
+	if err := json.Unmarshal(data, mf); err != nil {
+		return nil, fmt.Errorf("decoding manifest: %w", err)
+	}
+	if mf.Files == nil {
+		mf.Files = make(map[string]manifestEntry)
+	}
+	return mf, nil
+}
+
+// recordBuild records roots the index is built from, together with
+// the settings and state of the tree at the time of the build.
+func (mf *manifest) recordBuild(roots []Root, settings *Settings, version string) error {
+	mf.Roots = make([]manifestRoot, 0, len(roots))
+	for _, root := range roots {
+		dir, err := filepath.Abs(root.Path)
+		if err != nil {
+			return fmt.Errorf("resolving root: %w", err)
+		}
+		entry := manifestRoot{
+			Alias:   root.Alias,
+			Path:    root.Path,
+			Dir:     dir,
+			Module:  root.module,
+			Version: root.version,
+		}
+		// Module cache is not a repository
+		if root.module == "" {
+			entry.GitHead = gitHead(dir)
+		}
+		mf.Roots = append(mf.Roots, entry)
+	}
+	mf.BuiltAt = time.Now()
+	mf.ToolVersion = version
+	mf.Options = newOptionsRecord(settings)
+	return nil
+}
+
+func newOptionsRecord(settings *Settings) optionsRecord {
+	return optionsRecord{
+		IndexType:       settings.IndexType,
+		MaxFileSize:     settings.MaxFileSize,
+		ExcludeDirs:     settings.ExcludeDirs,
+		ExtraExtensions: settings.ExtraExtensions,
+		DenyFiles:       settings.DenyFiles,
+		NoGitignore:     settings.NoGitignore,
+		Deps:            settings.IndexDeps,
+		History:         settings.HistoryCommits,
+	}
+}
+
+func (o optionsRecord) equal(other optionsRecord) bool {
+	return o.IndexType == other.IndexType &&
+		o.MaxFileSize == other.MaxFileSize &&
+		slices.Equal(o.ExcludeDirs, other.ExcludeDirs) &&
+		slices.Equal(o.ExtraExtensions, other.ExtraExtensions) &&
+		slices.Equal(o.DenyFiles, other.DenyFiles) &&
+		o.NoGitignore == other.NoGitignore &&
+		o.Deps == other.Deps &&
+		o.History == other.History
+}
+
+// apply sets indexing options of settings to the recorded ones.
+func (o optionsRecord) apply(settings *Settings) {
+	settings.IndexType = o.IndexType
+	settings.MaxFileSize = o.MaxFileSize
+	settings.ExcludeDirs = o.ExcludeDirs
+	settings.ExtraExtensions = o.ExtraExtensions
+	settings.DenyFiles = o.DenyFiles
+	settings.NoGitignore = o.NoGitignore
+	settings.IndexDeps = o.Deps
+	settings.HistoryCommits = o.History
+}
+
+// indexedRoots returns roots the index was built from, dependency roots excluded.
+func (mf *manifest) indexedRoots() []Root {
+	var roots []Root
+	for _, root := range mf.Roots {
+		if root.Module == "" {
+			roots = append(roots, Root{Alias: root.Alias, Path: root.Dir})
+		}
+	}
+	return roots
+}
+
+// sameRoots reports whether roots are the ones the index was built from.
+func (mf *manifest) sameRoots(roots []Root) bool {
+	indexed := mf.indexedRoots()
+	if len(indexed) != len(roots) {
+		return false
+	}
+	for _, root := range roots {
+		other, ok := mf.root(root.Alias)
+		dir, err := filepath.Abs(root.Path)
+		if !ok || other.Module != "" || err != nil || dir != other.Dir {
+			return false
+		}
+	}
+	return true
+}
+
+// root returns indexed root with given alias.
+func (mf *manifest) root(alias string) (manifestRoot, bool) {
+	for _, root := range mf.Roots {
+		if root.Alias == alias {
+			return root, true
+		}
+	}
+	return manifestRoot{}, false
+}
+
+// splitID splits file id into alias of its root and path relative to the root.
+// Id without alias of a known root belongs to the unaliased root, if there is one.
+func (mf *manifest) splitID(id string) (string, string) {
+	if alias, path, found := strings.Cut(id, ":"); found {
+		if _, ok := mf.root(alias); ok && alias != "" {
+			return alias, path
+		}
+	}
+	return "", id
+}
+
+// filePath returns path of an indexed file on disk.
+func (mf *manifest) filePath(id string) string {
+	alias, path := mf.splitID(id)
+	root, ok := mf.root(alias)
+	if !ok {
+		return path
+	}
+	return filepath.Join(root.Dir, filepath.FromSlash(path))
+}
+
+// save adds manifest to the batch, so it is persisted together with documents.
+func (mf *manifest) save(batch *bleve.Batch) error {
+	mf.UpdatedAt = time.Now()
+	mf.countTypes()
+
+	data, err := json.Marshal(mf)
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	batch.SetInternal(manifestKey, data)
+	return nil
+}
+
+// countTypes updates number of files per type.
+func (mf *manifest) countTypes() {
+	mf.Types = make(map[string]int)
+	for id := range mf.Files {
+		mf.Types[mf.fileType(id)]++
+	}
+	for _, hashes := range mf.Commits {
+		mf.Types[typeCommit] += len(hashes)
+	}
+}
+
+// fileType returns type of an indexed file, all files of dependencies share the same type.
+func (mf *manifest) fileType(id string) string {
+	alias, path := mf.splitID(id)
+	if root, ok := mf.root(alias); ok && root.Module != "" {
+		return typeDependency
+	}
+	return getFileType(path)
+}
+
+// unchanged reports whether file metadata matches the manifest entry.
+func (mf *manifest) unchanged(path string, info os.FileInfo) bool {
+	entry, ok := mf.Files[path]
+	if !ok {
+		return false
+	}
+	return entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime())
+}
+
+// racyWindow is the modification time granularity of the coarsest file systems.
+const racyWindow = 2 * time.Second
+
+// racy reports whether file was modified so shortly before it was read, that later writes
+// could have kept its modification time, so its content must be compared instead.
+func (mf *manifest) racy(path string) bool {
+	entry, ok := mf.Files[path]
+	return !ok || entry.Indexed.Sub(entry.ModTime) <= racyWindow
+}
+
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// gitHead returns commit checked out in dir, or empty string if dir is not in a git repository.
+func gitHead(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,267 @@
+package kwb
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// headingSeparator joins headings of a section with headings of its parents.
+const headingSeparator = " > "
+
+// section is a part of markdown file starting with a heading.
+// Text before the first heading is a section without heading.
+type section struct {
+	Heading   string   // heading path, e.g. "Workflows > Debugging"
+	Headings  []string // headings of parents and of the section itself
+	Anchor    string   // GitHub-style anchor of the heading
+	Level     int      // number of # of the heading, 0 for text before the first heading
+	StartLine int
+	EndLine   int // last line before the next heading of any level
+}
+
+// parseMarkdownSections splits lines into sections, one per ATX heading.
+// Headings inside fenced code blocks are ignored.
+func parseMarkdownSections(lines []string) []section {
+	var (
+		sections []section
+		parents  []section // enclosing sections, outermost first
+		fence    string
+		anchors  = make(map[string]int)
+	)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		level, heading, ok := atxHeading(line)
+		if !ok {
+			if len(sections) == 0 && trimmed != "" {
+				sections = append(sections, section{StartLine: i + 1})
+			}
+			continue
+		}
+
+		for len(parents) > 0 && parents[len(parents)-1].Level >= level {
+			parents = parents[:len(parents)-1]
+		}
+		headings := make([]string, 0, len(parents)+1)
+		for _, parent := range parents {
+			headings = append(headings, parent.Headings[len(parent.Headings)-1])
+		}
+		headings = append(headings, heading)
+
+		s := section{
+			Heading:   strings.Join(headings, headingSeparator),
+			Headings:  headings,
+			Anchor:    uniqueAnchor(anchors, headingAnchor(heading)),
+			Level:     level,
+			StartLine: i + 1,
+		}
+		sections = append(sections, s)
+		parents = append(parents, s)
+	}
+
+	for i := range sections {
+		if i+1 < len(sections) {
+			sections[i].EndLine = sections[i+1].StartLine - 1
+		} else {
+			sections[i].EndLine = len(lines)
+		}
+	}
+	return sections
+}
+
+// atxHeading parses heading like "## Title ##", up to three leading spaces are allowed.
+func atxHeading(line string) (int, string, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	if indent > 3 {
+		return 0, "", false
+	}
+	line = line[indent:]
+
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 {
+		return 0, "", false
+	}
+	rest := line[level:]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return 0, "", false
+	}
+
+	heading := strings.TrimSpace(rest)
+	// Closing sequence must be separated by space
+	if trimmed := strings.TrimRight(heading, "#"); trimmed == "" || strings.HasSuffix(trimmed, " ") {
+		heading = strings.TrimSpace(trimmed)
+	}
+	if heading == "" {
+		return 0, "", false
+	}
+	return level, heading, true
+}
+
+// headingAnchor returns anchor GitHub generates for heading:
+// lower case, punctuation removed and spaces replaced with hyphens.
+func headingAnchor(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// uniqueAnchor suffixes repeated anchors of a file with -1, -2 and so on.
+func uniqueAnchor(seen map[string]int, anchor string) string {
+	n := seen[anchor]
+	seen[anchor] = n + 1
+	if n == 0 {
+		return anchor
+	}
+	return fmt.Sprintf("%s-%d", anchor, n)
+}
+
+// sectionDocuments returns documents of sections of a markdown file,
+// sections longer than chunkLines are split into chunks.
+// Returns nil if file has no headings.
+func sectionDocuments(path string, lines []string, chunkLines, chunkOverlap int) []document {
+	sections := parseMarkdownSections(lines)
+	if len(sections) == 0 || (len(sections) == 1 && sections[0].Level == 0) {
+		return nil
+	}
+
+	var docs []document
+	for _, s := range sections {
+		sectionLines := lines[s.StartLine-1 : s.EndLine]
+		chunks := splitChunks(sectionLines, chunkLines, chunkOverlap)
+		if len(chunks) == 0 {
+			chunks = []chunk{{
+				Content:   strings.Join(sectionLines, ""),
+				StartLine: 1,
+				EndLine:   len(sectionLines),
+			}}
+		}
+		for _, c := range chunks {
+			c.StartLine += s.StartLine - 1
+			c.EndLine += s.StartLine - 1
+			docs = append(docs, document{
+				ID:        fmt.Sprintf("%s#%s:%d-%d", path, kindSection, c.StartLine, c.EndLine),
+				Path:      path,
+				Content:   c.Content,
+				Kind:      kindSection,
+				StartLine: c.StartLine,
+				EndLine:   c.EndLine,
+				Section:   s.Heading,
+				Anchor:    s.Anchor,
+			})
+		}
+	}
+	return docs
+}
+
+// Section is a section of markdown file together with its subsections.
+type Section struct {
+	Path      string `json:"path"`
+	Heading   string `json:"heading"` // heading path, e.g. "Workflows > Debugging"
+	Anchor    string `json:"anchor"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Content   string `json:"content"`
+}
+
+// GetSection returns section of a markdown file, including its subsections.
+// Section is given by its anchor, with or without leading #, by its heading path,
+// or by its own heading if that is unique within the file.
+func (s *searcher) GetSection(path, name string) (*Section, error) {
+	if filepath.Ext(path) != ".md" {
+		return nil, fmt.Errorf("sections are not supported for %s files", getFileType(path))
+	}
+	content, err := s.GetFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := splitLines(content)
+	sections := parseMarkdownSections(lines)
+	i, err := findSection(sections, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	found := sections[i]
+	end := len(lines)
+	for _, next := range sections[i+1:] {
+		if next.Level <= found.Level {
+			end = next.StartLine - 1
+			break
+		}
+	}
+	return &Section{
+		Path:      path,
+		Heading:   found.Heading,
+		Anchor:    found.Anchor,
+		StartLine: found.StartLine,
+		EndLine:   end,
+		Content:   strings.Join(lines[found.StartLine-1:end], ""),
+	}, nil
+}
+
+// findSection returns index of section matching name, see GetSection.
+func findSection(sections []section, name string) (int, error) {
+	name = strings.TrimSpace(name)
+	anchor := strings.TrimPrefix(name, "#")
+	for i, s := range sections {
+		if s.Level > 0 && s.Anchor == anchor {
+			return i, nil
+		}
+	}
+
+	normalized := normalizeHeading(name)
+	var matches []int
+	for i, s := range sections {
+		if s.Level == 0 {
+			continue
+		}
+		if normalizeHeading(s.Heading) == normalized {
+			return i, nil
+		}
+		if strings.EqualFold(s.Headings[len(s.Headings)-1], name) {
+			matches = append(matches, i)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("section %q not found", name)
+	case 1:
+		return matches[0], nil
+	default:
+		return 0, fmt.Errorf("several sections are named %q, use heading path (e.g. %q) or anchor",
+			name, sections[matches[0]].Heading)
+	}
+}
+
+// normalizeHeading makes heading paths comparable regardless of case and spacing around separators.
+func normalizeHeading(heading string) string {
+	parts := strings.Split(heading, ">")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.Join(strings.Fields(part), " "))
+	}
+	return strings.Join(parts, headingSeparator)
+}
@@ -0,0 +1,94 @@
+package kwb
+
+import (
+	"testing"
+)
+
+func TestHeadingAnchor(t *testing.T) {
+	tests := []struct {
+		heading string
+		want    string
+	}{
+		{heading: "Getting Started", want: "getting-started"},
+		{heading: "Hello, World!", want: "hello-world"},
+		{heading: "API v2.0 (beta)", want: "api-v20-beta"},
+		{heading: "snake_case and kebab-case", want: "snake_case-and-kebab-case"},
+		{heading: "Use `kwb build`", want: "use-kwb-build"},
+		{heading: "Ünïcode Heading", want: "ünïcode-heading"},
+		{heading: "A  --  B", want: "a------b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.heading, func(t *testing.T) {
+			if got := headingAnchor(tt.heading); got != tt.want {
+				t.Errorf("headingAnchor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMarkdownSections(t *testing.T) {
+	lines := splitLines("Intro text\n" + // 1
+		"# Guide\n" + // 2
+		"## Setup ##\n" + // 3
+		"text\n" + // 4
+		"```sh\n" + // 5
+		"# not a heading\n" + // 6
+		"```\n" + // 7
+		"### Notes\n" + // 8
+		"## Usage\n" + // 9
+		"### Notes\n" + // 10
+		"#hashtag\n" + // 11
+		"    # indented code\n" + // 12
+		"# Appendix\n") // 13
+
+	want := []section{
+		{Heading: "", Anchor: "", Level: 0, StartLine: 1, EndLine: 1},
+		{Heading: "Guide", Anchor: "guide", Level: 1, StartLine: 2, EndLine: 2},
+		{Heading: "Guide > Setup", Anchor: "setup", Level: 2, StartLine: 3, EndLine: 7},
+		{Heading: "Guide > Setup > Notes", Anchor: "notes", Level: 3, StartLine: 8, EndLine: 8},
+		{Heading: "Guide > Usage", Anchor: "usage", Level: 2, StartLine: 9, EndLine: 9},
+		{Heading: "Guide > Usage > Notes", Anchor: "notes-1", Level: 3, StartLine: 10, EndLine: 12},
+		{Heading: "Appendix", Anchor: "appendix", Level: 1, StartLine: 13, EndLine: 13},
+	}
+
+	got := parseMarkdownSections(lines)
+	if len(got) != len(want) {
+		t.Fatalf("got %d sections, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Heading != w.Heading || g.Anchor != w.Anchor || g.Level != w.Level ||
+			g.StartLine != w.StartLine || g.EndLine != w.EndLine {
+			t.Errorf("section %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestFindSection(t *testing.T) {
+	sections := parseMarkdownSections(splitLines("# Guide\n## Notes\n# Reference\n## Notes\n## Setup\n"))
+
+	tests := []struct {
+		name    string
+		want    int
+		wantErr bool
+	}{
+		{name: "#notes-1", want: 3},
+		{name: "notes", want: 1},
+		{name: "reference >  notes", want: 3},
+		{name: "Guide > Notes", want: 1},
+		{name: "setup", want: 4},
+		{name: "Notes", wantErr: true},
+		{name: "Missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findSection(sections, tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findSection() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("findSection() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -9,3 +9,17 @@ func WithLogger(logger *slog.Logger) Option {
 		s.logger = logger
 	}
 }
+
+// WithVersion sets version of the tool recorded in built indexes.
+func WithVersion(version string) Option {
+	return func(s *Service) {
+		s.version = version
+	}
+}
+
+// WithEmbedder sets embedder used for semantic search instead of the one selected in settings.
+func WithEmbedder(embedder Embedder) Option {
+	return func(s *Service) {
+		s.embedder = embedder
+	}
+}
@@ -0,0 +1,405 @@
+package kwb
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	symbolService   = "service"
+	symbolRPC       = "rpc"
+	symbolMessage   = "message"
+	symbolField     = "field"
+	symbolEnum      = "enum"
+	symbolEnumValue = "enum_value"
+)
+
+type protoToken struct {
+	text string
+	line int
+}
+
+// protoComment is a block comment, or a run of line comments on consecutive lines.
+type protoComment struct {
+	text      string
+	startLine int
+	endLine   int
+}
+
+// parseProtoSymbols extracts services, rpcs, messages, enums and their fields
+// of a protobuf file as separate documents.
+// Nested declarations are qualified by their parents, e.g. field id of message User is User.id.
+func parseProtoSymbols(path string, content []byte) ([]document, error) {
+	tokens, comments, err := tokenizeProto(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("parsing proto file: %w", err)
+	}
+
+	p := &protoParser{
+		path:     path,
+		lines:    splitLines(string(content)),
+		tokens:   tokens,
+		comments: make(map[int]protoComment, len(comments)),
+	}
+	for _, c := range comments {
+		p.comments[c.endLine] = c
+	}
+	p.parseFile()
+	return p.docs, nil
+}
+
+// tokenizeProto splits protobuf source into identifiers, literals and punctuation.
+// Dots are part of identifiers, so qualified type names are single tokens.
+func tokenizeProto(src string) ([]protoToken, []protoComment, error) {
+	var (
+		tokens   []protoToken
+		comments []protoComment
+	)
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			text := strings.TrimSpace(strings.TrimPrefix(src[i:i+end], "//"))
+			if n := len(comments); n > 0 && comments[n-1].endLine == line-1 {
+				comments[n-1].text += "\n" + text
+				comments[n-1].endLine = line
+			} else {
+				comments = append(comments, protoComment{text: text, startLine: line, endLine: line})
+			}
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			body := src[i+2 : i+2+end]
+			start := line
+			line += strings.Count(body, "\n")
+			comments = append(comments, protoComment{text: strings.TrimSpace(body), startLine: start, endLine: line})
+			i += end + 4
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) || src[j] != c {
+				return nil, nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			tokens = append(tokens, protoToken{text: src[i : j+1], line: line})
+			i = j + 1
+		case isProtoIdentByte(c):
+			j := i
+			for j < len(src) && isProtoIdentByte(src[j]) {
+				j++
+			}
+			tokens = append(tokens, protoToken{text: src[i:j], line: line})
+			i = j
+		default:
+			tokens = append(tokens, protoToken{text: string(c), line: line})
+			i++
+		}
+	}
+	return tokens, comments, nil
+}
+
+func isProtoIdentByte(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+type protoParser struct {
+	path     string
+	lines    []string
+	tokens   []protoToken
+	pos      int
+	pkg      string
+	comments map[int]protoComment // by last line
+	docs     []document
+}
+
+func (p *protoParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *protoParser) next() protoToken {
+	if p.done() {
+		return protoToken{}
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+func (p *protoParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos].text
+}
+
+// lastLine returns line of the previous token.
+func (p *protoParser) lastLine() int {
+	if p.pos == 0 || len(p.tokens) == 0 {
+		return 1
+	}
+	return p.tokens[min(p.pos, len(p.tokens))-1].line
+}
+
+func (p *protoParser) parseFile() {
+	for !p.done() {
+		t := p.next()
+		switch t.text {
+		case "package":
+			p.pkg = strings.Join(p.statement(), "")
+		case "service":
+			p.parseService(t)
+		case "message":
+			p.parseMessage(t, "")
+		case "enum":
+			p.parseEnum(t, "")
+		case "{":
+			p.skipBlock()
+		case ";":
+		default:
+			// syntax, import, option, extend and anything unknown
+			p.skipStatement()
+		}
+	}
+}
+
+func (p *protoParser) parseService(start protoToken) {
+	name := p.next().text
+	i := p.add(name, symbolService, "", "service "+name, start.line)
+	if p.next().text != "{" {
+		return
+	}
+	for !p.done() {
+		t := p.next()
+		switch t.text {
+		case "}":
+			p.end(i)
+			return
+		case "rpc":
+			p.parseRPC(t, name)
+		case ";":
+		default:
+			p.skipStatement()
+		}
+	}
+	p.end(i)
+}
+
+// parseRPC parses "rpc Name (stream Request) returns (Response)" followed by ";" or options block.
+func (p *protoParser) parseRPC(start protoToken, service string) {
+	name := p.next().text
+	var sig strings.Builder
+	sig.WriteString("rpc " + name)
+	for !p.done() {
+		switch t := p.next().text; t {
+		case ";":
+			p.end(p.add(name, symbolRPC, service, sig.String(), start.line))
+			return
+		case "{":
+			i := p.add(name, symbolRPC, service, sig.String(), start.line)
+			p.skipBlock()
+			p.end(i)
+			return
+		case "(", ")":
+			sig.WriteString(t)
+		case "returns":
+			sig.WriteString(" returns ")
+		case "stream":
+			sig.WriteString("stream ")
+		default:
+			sig.WriteString(t)
+		}
+	}
+}
+
+func (p *protoParser) parseMessage(start protoToken, parent string) {
+	name := p.next().text
+	qualified := qualifyProto(parent, name)
+	i := p.add(name, symbolMessage, parent, "message "+qualified, start.line)
+	if p.next().text != "{" {
+		return
+	}
+	p.parseMessageBody(qualified)
+	p.end(i)
+}
+
+// parseMessageBody parses declarations of message, or of oneof within it, up to closing brace.
+func (p *protoParser) parseMessageBody(message string) {
+	for !p.done() {
+		t := p.tokens[p.pos]
+		switch t.text {
+		case "}":
+			p.pos++
+			return
+		case ";":
+			p.pos++
+		case "message":
+			p.pos++
+			p.parseMessage(t, message)
+		case "enum":
+			p.pos++
+			p.parseEnum(t, message)
+		case "oneof":
+			p.next() // oneof
+			p.next() // name
+			if p.next().text == "{" {
+				p.parseMessageBody(message)
+			}
+		case "option", "reserved", "extensions", "extend":
+			p.pos++
+			p.skipStatement()
+		default:
+			p.parseField(message)
+		}
+	}
+}
+
+// parseField parses "[label] type name = number [options];", including map fields.
+func (p *protoParser) parseField(message string) {
+	start := p.tokens[p.pos].line
+	tokens := p.statement()
+	name := ""
+	for i, t := range tokens {
+		if t == "=" && i > 0 {
+			name = tokens[i-1]
+			tokens = tokens[:min(i+2, len(tokens))]
+			break
+		}
+	}
+	if name == "" {
+		return
+	}
+	sig := strings.Join(tokens, " ")
+	sig = strings.NewReplacer(" < ", "<", " , ", ", ", " >", ">").Replace(sig)
+	p.end(p.add(name, symbolField, message, sig, start))
+}
+
+func (p *protoParser) parseEnum(start protoToken, parent string) {
+	name := p.next().text
+	qualified := qualifyProto(parent, name)
+	i := p.add(name, symbolEnum, parent, "enum "+qualified, start.line)
+	if p.next().text != "{" {
+		return
+	}
+	for !p.done() {
+		t := p.tokens[p.pos]
+		switch t.text {
+		case "}":
+			p.pos++
+			p.end(i)
+			return
+		case ";":
+			p.pos++
+		case "option", "reserved":
+			p.pos++
+			p.skipStatement()
+		default:
+			tokens := p.statement()
+			if len(tokens) >= 3 && tokens[1] == "=" {
+				sig := tokens[0] + " = " + strings.Join(tokens[2:], "")
+				if j := strings.IndexByte(sig, '['); j > 0 {
+					sig = sig[:j]
+				}
+				p.end(p.add(tokens[0], symbolEnumValue, qualified, sig, t.line))
+			}
+		}
+	}
+	p.end(i)
+}
+
+// statement returns tokens up to the closing semicolon, which is consumed.
+func (p *protoParser) statement() []string {
+	var tokens []string
+	for !p.done() {
+		t := p.next()
+		if t.text == ";" {
+			break
+		}
+		tokens = append(tokens, t.text)
+	}
+	return tokens
+}
+
+// skipStatement skips tokens up to semicolon or through a block, whichever comes first.
+func (p *protoParser) skipStatement() {
+	for !p.done() {
+		switch p.next().text {
+		case ";":
+			return
+		case "{":
+			p.skipBlock()
+			return
+		}
+	}
+}
+
+// skipBlock skips tokens through the brace closing already consumed opening brace.
+func (p *protoParser) skipBlock() {
+	depth := 1
+	for !p.done() && depth > 0 {
+		switch p.next().text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+	}
+}
+
+// add adds symbol starting at line, end of the symbol is set by end once it is parsed.
+// Returns index of the symbol document.
+func (p *protoParser) add(name, kind, parent, signature string, line int) int {
+	start := line
+	doc, ok := p.comments[line-1]
+	if ok {
+		start = doc.startLine
+	}
+
+	qualified := qualifyProto(parent, name)
+	p.docs = append(p.docs, document{
+		ID:         fmt.Sprintf("%s#%s:%s:%d", p.path, kindSymbol, qualified, start),
+		Path:       p.path,
+		Type:       getFileType(p.path),
+		Kind:       kindSymbol,
+		Package:    p.pkg,
+		Receiver:   parent,
+		Name:       name,
+		SymbolKind: kind,
+		Signature:  signature,
+		Doc:        doc.text,
+		StartLine:  start,
+	})
+	return len(p.docs) - 1
+}
+
+// end sets end line and content of symbol to the line of the last consumed token.
+func (p *protoParser) end(i int) {
+	doc := &p.docs[i]
+	doc.EndLine = max(p.lastLine(), doc.StartLine)
+	if doc.EndLine <= len(p.lines) {
+		doc.Content = strings.Join(p.lines[doc.StartLine-1:doc.EndLine], "")
+	}
+}
+
+func qualifyProto(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
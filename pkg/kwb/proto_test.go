@@ -0,0 +1,108 @@
+package kwb
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseProtoSymbols_Truncated(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "message", content: "message M {"},
+		{name: "message name", content: "message"},
+		{name: "service rpc", content: "service S { rpc"},
+		{name: "rpc signature", content: "service S { rpc Get(Request) returns"},
+		{name: "trailing oneof", content: "syntax = \"proto3\";\nmessage M {\n  oneof"},
+		{name: "oneof name", content: "message M {\n  oneof kind"},
+		{name: "oneof body", content: "message M {\n  oneof kind {\n    string a = 1;"},
+		{name: "enum", content: "enum E {\n  A = 0"},
+		{name: "field", content: "message M {\n  string name ="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("parseProtoSymbols panicked: %v", r)
+				}
+			}()
+			if _, err := parseProtoSymbols("api/m.proto", []byte(tt.content)); err != nil {
+				t.Fatalf("parseProtoSymbols() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestParseProtoSymbols(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "service",
+			content: "syntax = \"proto3\";\n" +
+				"service Users {\n" +
+				"  rpc Get(GetRequest) returns (User);\n" +
+				"}\n",
+			want: []string{"service Users:2", "rpc Users.Get:3"},
+		},
+		{
+			name: "nested messages",
+			content: "message User {\n" +
+				"  message Address {\n" +
+				"    string city = 1;\n" +
+				"  }\n" +
+				"  Address address = 1;\n" +
+				"}\n",
+			want: []string{
+				"message User:1",
+				"message User.Address:2",
+				"field User.Address.city:3",
+				"field User.address:5",
+			},
+		},
+		{
+			name: "oneof",
+			content: "message Event {\n" +
+				"  oneof payload {\n" +
+				"    string text = 1;\n" +
+				"    bytes data = 2;\n" +
+				"  }\n" +
+				"}\n",
+			want: []string{"message Event:1", "field Event.text:3", "field Event.data:4"},
+		},
+		{
+			name: "map fields",
+			content: "message Labels {\n" +
+				"  map<string, string> values = 1;\n" +
+				"  map<string, Labels> nested = 2 [deprecated = true];\n" +
+				"}\n",
+			want: []string{"message Labels:1", "field Labels.values:2", "field Labels.nested:3"},
+		},
+		{
+			name: "enum",
+			content: "enum Status {\n" +
+				"  STATUS_UNSPECIFIED = 0;\n" +
+				"  STATUS_ACTIVE = 1;\n" +
+				"}\n",
+			want: []string{
+				"enum Status:1",
+				"enum_value Status.STATUS_UNSPECIFIED:2",
+				"enum_value Status.STATUS_ACTIVE:3",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := parseProtoSymbols("api/m.proto", []byte(tt.content))
+			if err != nil {
+				t.Fatalf("parseProtoSymbols() error = %v", err)
+			}
+			if got := symbolSummary(docs); !slices.Equal(got, tt.want) {
+				t.Errorf("parseProtoSymbols() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package kwb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// SearchOptions narrows down and orders search results.
+type SearchOptions struct {
+	Repos        []string // aliases of indexed roots
+	Types        []string // document types, e.g. code, documentation
+	Paths        []string // path globs or directory prefixes to include
+	ExcludePaths []string // path globs or directory prefixes to exclude
+	Extensions   []string // file extensions, with or without leading dot
+	Offset       int
+	Limit        int    // 0 = configured search limit
+	Sort         string // score (default), path, type, prefix with "-" for descending
+	Facets       bool   // count matching files per type and top-level directory
+	Mode         string // keyword (default), semantic or hybrid
+}
+
+// hasFilters reports whether options narrow down matching documents.
+func (o SearchOptions) hasFilters() bool {
+	return len(o.Repos) > 0 || len(o.Types) > 0 || len(o.Extensions) > 0 ||
+		len(o.Paths) > 0 || len(o.ExcludePaths) > 0
+}
+
+// sortFields maps sort option names to index fields.
+var sortFields = map[string]string{
+	"score": "_score",
+	"path":  "path",
+	"type":  "type",
+}
+
+// sortOrder converts sort option into bleve sort order.
+// Ranked by score, documents of dependencies come after all project documents.
+func (o SearchOptions) sortOrder() ([]string, error) {
+	if o.Sort == "" || o.Sort == "score" {
+		return []string{"dependency", "-_score", "_id"}, nil
+	}
+	desc := strings.HasPrefix(o.Sort, "-")
+	field, ok := sortFields[strings.TrimPrefix(o.Sort, "-")]
+	if !ok {
+		return nil, fmt.Errorf("invalid sort order: %s", o.Sort)
+	}
+	// Score is naturally sorted from best to worst
+	if field == "_score" {
+		desc = !desc
+	}
+	if desc {
+		field = "-" + field
+	}
+	return []string{field, "_id"}, nil
+}
+
+// withFilters combines user query with filters from options.
+func (o SearchOptions) withFilters(q query.Query) (query.Query, error) {
+	var must, mustNot []query.Query
+
+	if len(o.Repos) > 0 {
+		must = append(must, termsQuery("repo", o.Repos))
+	}
+
+	if len(o.Types) > 0 {
+		must = append(must, termsQuery("type", o.Types))
+	}
+
+	if len(o.Extensions) > 0 {
+		exts := make([]string, 0, len(o.Extensions))
+		for _, ext := range o.Extensions {
+			exts = append(exts, normalizeExt(ext))
+		}
+		must = append(must, termsQuery("ext", exts))
+	}
+
+	if len(o.Paths) > 0 {
+		include, err := pathsQuery(o.Paths)
+		if err != nil {
+			return nil, err
+		}
+		must = append(must, include)
+	}
+
+	for _, glob := range o.ExcludePaths {
+		exclude, err := pathQuery(glob)
+		if err != nil {
+			return nil, err
+		}
+		mustNot = append(mustNot, exclude)
+	}
+
+	if len(must) == 0 && len(mustNot) == 0 {
+		return q, nil
+	}
+
+	boolQuery := bleve.NewBooleanQuery()
+	boolQuery.AddMust(q)
+	boolQuery.AddMust(must...)
+	boolQuery.AddMustNot(mustNot...)
+	return boolQuery, nil
+}
+
+func termsQuery(field string, values []string) query.Query {
+	disjuncts := make([]query.Query, 0, len(values))
+	for _, value := range values {
+		termQuery := bleve.NewTermQuery(value)
+		termQuery.SetField(field)
+		disjuncts = append(disjuncts, termQuery)
+	}
+	return bleve.NewDisjunctionQuery(disjuncts...)
+}
+
+func pathsQuery(globs []string) (query.Query, error) {
+	disjuncts := make([]query.Query, 0, len(globs))
+	for _, glob := range globs {
+		q, err := pathQuery(glob)
+		if err != nil {
+			return nil, err
+		}
+		disjuncts = append(disjuncts, q)
+	}
+	return bleve.NewDisjunctionQuery(disjuncts...), nil
+}
+
+// pathQuery matches path field against a glob.
+func pathQuery(glob string) (query.Query, error) {
+	return globQuery("path", glob)
+}
+
+// globQuery matches values of a keyword field holding paths against glob.
+func globQuery(field, glob string) (query.Query, error) {
+	expr, err := globToRegexp(glob)
+	if err != nil {
+		return nil, err
+	}
+	q := bleve.NewRegexpQuery(expr)
+	q.SetField(field)
+	return q, nil
+}
+
+// globToRegexp converts path glob into regular expression matching whole path.
+// "*" and "?" do not cross directory boundaries, "**" does.
+// Glob without wildcards matches the path itself and everything beneath it.
+func globToRegexp(glob string) (string, error) {
+	glob = strings.TrimPrefix(glob, "./")
+	if glob == "" {
+		return "", fmt.Errorf("empty path pattern")
+	}
+
+	if !strings.ContainsAny(glob, "*?[") {
+		prefix := regexp.QuoteMeta(strings.TrimSuffix(glob, "/"))
+		return prefix + "(/.*)?", nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '*' && strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("invalid path pattern %q: unterminated character class", glob)
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	expr := b.String()
+	if _, err := regexp.Compile(expr); err != nil {
+		return "", fmt.Errorf("invalid path pattern %q: %w", glob, err)
+	}
+	return expr, nil
+}
+
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
@@ -0,0 +1,158 @@
+package kwb
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob     string
+		match    []string
+		notMatch []string
+	}{
+		{
+			glob:     "pkg/kwb",
+			match:    []string{"pkg/kwb", "pkg/kwb/index.go", "pkg/kwb/sub/x.go"},
+			notMatch: []string{"pkg/kwbx/index.go", "internal/pkg/kwb/x.go"},
+		},
+		{
+			glob:     "./pkg/kwb/",
+			match:    []string{"pkg/kwb/index.go"},
+			notMatch: []string{"pkg/kwbx"},
+		},
+		{
+			glob:     "pkg/*.go",
+			match:    []string{"pkg/main.go"},
+			notMatch: []string{"pkg/kwb/index.go", "pkg/main.go.bak"},
+		},
+		{
+			glob:     "**/*_test.go",
+			match:    []string{"a_test.go", "pkg/kwb/index_test.go"},
+			notMatch: []string{"pkg/kwb/index.go"},
+		},
+		{
+			glob:     "vendor/**",
+			match:    []string{"vendor/a/b.go"},
+			notMatch: []string{"pkg/vendor/a.go"},
+		},
+		{
+			glob:     "cmd/?.go",
+			match:    []string{"cmd/a.go"},
+			notMatch: []string{"cmd/ab.go", "cmd//.go"},
+		},
+		{
+			glob:     "docs/[a-c]*.md",
+			match:    []string{"docs/api.md", "docs/cli.md"},
+			notMatch: []string{"docs/usage.md"},
+		},
+		{
+			glob:     "docs/[!a]*.md",
+			match:    []string{"docs/usage.md"},
+			notMatch: []string{"docs/api.md"},
+		},
+		{
+			glob:     "a+b/(x).go",
+			match:    []string{"a+b/(x).go"},
+			notMatch: []string{"aab/x.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			expr, err := globToRegexp(tt.glob)
+			if err != nil {
+				t.Fatalf("globToRegexp() error = %v", err)
+			}
+			// Bleve regexp queries match whole terms
+			re := regexp.MustCompile("^(?:" + expr + ")$")
+			for _, path := range tt.match {
+				if !re.MatchString(path) {
+					t.Errorf("%s (%s) does not match %s", tt.glob, expr, path)
+				}
+			}
+			for _, path := range tt.notMatch {
+				if re.MatchString(path) {
+					t.Errorf("%s (%s) matches %s", tt.glob, expr, path)
+				}
+			}
+		})
+	}
+}
+
+func TestGlobToRegexp_Invalid(t *testing.T) {
+	for _, glob := range []string{"", "./", "docs/[a-c.md"} {
+		if expr, err := globToRegexp(glob); err == nil {
+			t.Errorf("globToRegexp(%q) = %q, want error", glob, expr)
+		}
+	}
+}
+
+func TestSearch_Filters(t *testing.T) {
+	s := newTestSearcher(t, map[string]string{
+		"pkg/kwb/index.go":      "package kwb\n\n// retry indexing\n",
+		"pkg/kwb/index_test.go": "package kwb\n\n// retry in tests\n",
+		"internal/cmd/root.go":  "package cmd\n\n// retry command\n",
+		"docs/retry.md":         "# Retry\n\nretry policy\n",
+		"config/retry.yaml":     "retry: 3\n",
+	})
+
+	tests := []struct {
+		name string
+		opts SearchOptions
+		want []string
+	}{
+		{
+			name: "no filters",
+			want: []string{
+				"config/retry.yaml", "docs/retry.md", "internal/cmd/root.go",
+				"pkg/kwb/index.go", "pkg/kwb/index_test.go",
+			},
+		},
+		{
+			name: "type",
+			opts: SearchOptions{Types: []string{"documentation", "config"}},
+			want: []string{"config/retry.yaml", "docs/retry.md"},
+		},
+		{
+			name: "path prefix and extension",
+			opts: SearchOptions{Paths: []string{"pkg"}, Extensions: []string{"GO"}},
+			want: []string{"pkg/kwb/index.go", "pkg/kwb/index_test.go"},
+		},
+		{
+			name: "path with excluded glob",
+			opts: SearchOptions{Paths: []string{"pkg", "internal"}, ExcludePaths: []string{"**/*_test.go"}},
+			want: []string{"internal/cmd/root.go", "pkg/kwb/index.go"},
+		},
+		{
+			name: "type with excluded directory",
+			opts: SearchOptions{Types: []string{"code"}, ExcludePaths: []string{"internal/"}},
+			want: []string{"pkg/kwb/index.go", "pkg/kwb/index_test.go"},
+		},
+		{
+			name: "extension and type disjoint",
+			opts: SearchOptions{Types: []string{"documentation"}, Extensions: []string{".go"}},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Sort = "path"
+			response, err := s.Search(context.Background(), "retry", opts)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			var paths []string
+			for _, result := range response.Results {
+				if !slices.Contains(paths, result.Path) {
+					paths = append(paths, result.Path)
+				}
+			}
+			if !slices.Equal(paths, tt.want) {
+				t.Errorf("Search() paths = %v, want %v", paths, tt.want)
+			}
+		})
+	}
+}
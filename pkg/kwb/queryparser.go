@@ -0,0 +1,270 @@
+package kwb
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// Field prefixes understood in search queries, e.g. "retry type:code -path:vendor/** repo:api".
+// Values of a prefix may be separated by commas, e.g. "ext:go,proto", and quoted, e.g. sym:"New*".
+// Clauses of the same prefix are alternatives, clauses of different prefixes must all match,
+// prefix preceded by "-" excludes matching documents.
+// Everything else is free text in bleve query string syntax.
+const (
+	prefixRepo    = "repo"
+	prefixType    = "type"
+	prefixPath    = "path"
+	prefixExt     = "ext"
+	prefixSymbol  = "sym"
+	prefixPackage = "pkg"
+)
+
+var queryPrefixes = []string{prefixRepo, prefixType, prefixPath, prefixExt, prefixSymbol, prefixPackage}
+
+// QueryError describes why search query could not be parsed.
+type QueryError struct {
+	Token  string // part of the query which is invalid, empty if it is the query as a whole
+	Reason string
+}
+
+func (e *QueryError) Error() string {
+	if e.Token == "" {
+		return "invalid query: " + e.Reason
+	}
+	return fmt.Sprintf("invalid query at %q: %s", e.Token, e.Reason)
+}
+
+// parsedQuery is a search query split into free text and field clauses.
+type parsedQuery struct {
+	text     string
+	must     []query.Query // one clause per prefix, values of a prefix are alternatives
+	mustNot  []query.Query
+	prefixes []string // prefixes of must clauses
+}
+
+func parseQuery(queryStr string) (*parsedQuery, error) {
+	tokens, err := splitQuery(queryStr)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := &parsedQuery{}
+	var (
+		text     []string
+		prefixes []string
+		included = make(map[string][]query.Query)
+	)
+	for _, token := range tokens {
+		prefix, value, negated, ok := fieldClause(token)
+		if !ok {
+			text = append(text, token)
+			continue
+		}
+		if value == "" {
+			return nil, &QueryError{Token: token, Reason: "missing value"}
+		}
+
+		clauses, err := prefixQueries(prefix, value)
+		if err != nil {
+			return nil, &QueryError{Token: token, Reason: err.Error()}
+		}
+		if negated {
+			parsed.mustNot = append(parsed.mustNot, clauses...)
+			continue
+		}
+		if _, seen := included[prefix]; !seen {
+			prefixes = append(prefixes, prefix)
+		}
+		included[prefix] = append(included[prefix], clauses...)
+	}
+
+	for _, prefix := range prefixes {
+		parsed.must = append(parsed.must, bleve.NewDisjunctionQuery(included[prefix]...))
+	}
+	parsed.text = strings.Join(text, " ")
+	parsed.prefixes = prefixes
+	return parsed, nil
+}
+
+// hasFields reports whether query has field clauses.
+func (p *parsedQuery) hasFields() bool {
+	return len(p.must) > 0 || len(p.mustNot) > 0
+}
+
+// excludeHistory excludes commits unless query or opts select documents by type.
+// Diffs repeat the code they change, which would crowd out the code itself.
+func (p *parsedQuery) excludeHistory(opts SearchOptions) {
+	if len(opts.Types) > 0 || slices.Contains(p.prefixes, prefixType) {
+		return
+	}
+	p.mustNot = append(p.mustNot, fieldTermQuery("kind", kindCommit))
+}
+
+// keywordQuery builds query for full-text search, fuzziness is only applied to free text.
+func (p *parsedQuery) keywordQuery(fuzziness int) (query.Query, error) {
+	var textQuery query.Query = bleve.NewMatchAllQuery()
+	if strings.TrimSpace(p.text) != "" {
+		var err error
+		textQuery, err = bleve.NewQueryStringQuery(p.text).Parse()
+		if err != nil {
+			return nil, &QueryError{Reason: syntaxErrorReason(err)}
+		}
+		if fuzziness > 0 {
+			applyFuzziness(textQuery, fuzziness)
+		}
+		if exact := exactIdentifierQuery(p.text); exact != nil {
+			boolQuery := bleve.NewBooleanQuery()
+			boolQuery.AddMust(textQuery)
+			boolQuery.AddShould(exact)
+			textQuery = boolQuery
+		}
+	}
+	return p.filter(textQuery), nil
+}
+
+// filter combines q with field clauses.
+func (p *parsedQuery) filter(q query.Query) query.Query {
+	if !p.hasFields() {
+		return q
+	}
+	boolQuery := bleve.NewBooleanQuery()
+	boolQuery.AddMust(q)
+	boolQuery.AddMust(p.must...)
+	boolQuery.AddMustNot(p.mustNot...)
+	return boolQuery
+}
+
+// syntaxErrorReason rewords errors of bleve query string parser, which do not say what is wrong.
+func syntaxErrorReason(err error) string {
+	reason := strings.TrimPrefix(err.Error(), "parse error: ")
+	if reason == "syntax error" {
+		return `syntax error, quote phrases with "..." and escape special characters +-=&|><!(){}[]^"~*?:\/ with \`
+	}
+	return reason
+}
+
+// splitQuery splits query into whitespace separated tokens, quoted parts may contain whitespace.
+func splitQuery(queryStr string) ([]string, error) {
+	var (
+		tokens  []string
+		token   strings.Builder
+		quoted  bool
+		escaped bool
+		start   int
+	)
+	for i, r := range queryStr {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			if !quoted {
+				start = i
+			}
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t' || r == '\n' || r == '\r'):
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+			continue
+		}
+		token.WriteRune(r)
+	}
+	if quoted {
+		return nil, &QueryError{Token: queryStr[start:], Reason: "unterminated quote"}
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens, nil
+}
+
+// fieldClause splits token like "-path:vendor/**" into prefix, unquoted value and negation,
+// ok is false if token does not start with a known prefix.
+func fieldClause(token string) (prefix, value string, negated, ok bool) {
+	negated = strings.HasPrefix(token, "-")
+	token = strings.TrimPrefix(strings.TrimPrefix(token, "-"), "+")
+
+	prefix, value, found := strings.Cut(token, ":")
+	if !found {
+		return "", "", false, false
+	}
+	prefix = strings.ToLower(prefix)
+	if !slices.Contains(queryPrefixes, prefix) {
+		return "", "", false, false
+	}
+
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		value = value[1 : len(value)-1]
+	}
+	return prefix, value, negated, true
+}
+
+// prefixQueries converts comma separated values of a prefix into queries, one per value.
+func prefixQueries(prefix, value string) ([]query.Query, error) {
+	var queries []query.Query
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		q, err := prefixQuery(prefix, v)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("missing value")
+	}
+	return queries, nil
+}
+
+func prefixQuery(prefix, value string) (query.Query, error) {
+	switch prefix {
+	case prefixRepo:
+		return fieldTermQuery("repo", value), nil
+	case prefixType:
+		return fieldTermQuery("type", strings.ToLower(value)), nil
+	case prefixExt:
+		return fieldTermQuery("ext", normalizeExt(value)), nil
+	case prefixPath:
+		return pathQuery(value)
+	case prefixPackage:
+		if hasWildcard(value) {
+			q := bleve.NewWildcardQuery(value)
+			q.SetField("package")
+			return q, nil
+		}
+		return fieldTermQuery("package", value), nil
+	case prefixSymbol:
+		// Symbol names are analyzed, so wildcards match lowercase terms
+		if hasWildcard(value) {
+			q := bleve.NewWildcardQuery(strings.ToLower(value))
+			q.SetField("name")
+			return q, nil
+		}
+		q := bleve.NewMatchQuery(value)
+		q.SetField("name")
+		q.SetOperator(query.MatchQueryOperatorAnd)
+		return q, nil
+	default:
+		return nil, fmt.Errorf("unknown prefix %s", prefix)
+	}
+}
+
+func fieldTermQuery(field, value string) query.Query {
+	q := bleve.NewTermQuery(value)
+	q.SetField(field)
+	return q
+}
+
+func hasWildcard(value string) bool {
+	return strings.ContainsAny(value, "*?")
+}
@@ -0,0 +1,137 @@
+package kwb
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSplitQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    []string
+		wantErr bool
+	}{
+		{query: "retry  backoff\t", want: []string{"retry", "backoff"}},
+		{query: `sym:"New Client" -path:vendor/**`, want: []string{`sym:"New Client"`, "-path:vendor/**"}},
+		{query: `"exact phrase" x`, want: []string{`"exact phrase"`, "x"}},
+		{query: `a\"b c`, want: []string{`a\"b`, "c"}},
+		{query: `sym:"unterminated`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := splitQuery(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldClause(t *testing.T) {
+	tests := []struct {
+		token   string
+		prefix  string
+		value   string
+		negated bool
+		ok      bool
+	}{
+		{token: "type:code", prefix: prefixType, value: "code", ok: true},
+		{token: "-path:vendor/**", prefix: prefixPath, value: "vendor/**", negated: true, ok: true},
+		{token: "+EXT:go,proto", prefix: prefixExt, value: "go,proto", ok: true},
+		{token: `sym:"New*"`, prefix: prefixSymbol, value: "New*", ok: true},
+		{token: "repo:", prefix: prefixRepo, ok: true},
+		{token: "content:retry"},
+		{token: "retry"},
+		{token: "-retry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			prefix, value, negated, ok := fieldClause(tt.token)
+			if prefix != tt.prefix || value != tt.value || negated != tt.negated || ok != tt.ok {
+				t.Errorf("fieldClause() = %q, %q, %v, %v, want %q, %q, %v, %v",
+					prefix, value, negated, ok, tt.prefix, tt.value, tt.negated, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseQuery_Errors(t *testing.T) {
+	for _, q := range []string{"type:", "ext:,", `path:"[a-`, `sym:"open`} {
+		_, err := parseQuery(q)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("parseQuery(%q) error = %v, want QueryError", q, err)
+		}
+	}
+}
+
+func TestSearch_QueryPrefixes(t *testing.T) {
+	s := newTestSearcher(t, map[string]string{
+		"pkg/client/client.go":  "package client\n\n// NewClient creates client with retry.\nfunc NewClient() {}\n",
+		"pkg/server/server.go":  "package server\n\n// NewServer will retry failed requests.\nfunc NewServer() {}\n",
+		"third_party/lib.go":    "package lib\n\n// retry helper\nfunc Retry() {}\n",
+		"api/service.proto":     "syntax = \"proto3\";\n\n// retry policy\nmessage Retry {}\n",
+		"docs/retry.md":         "# Retry\n\nretry policy\n",
+		"pkg/client/client.yml": "retry: 3\n",
+	})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{
+			query: "retry type:code",
+			want:  []string{"pkg/client/client.go", "pkg/server/server.go", "third_party/lib.go"},
+		},
+		{
+			query: "retry type:code -path:third_party/**",
+			want:  []string{"pkg/client/client.go", "pkg/server/server.go"},
+		},
+		{
+			query: "retry ext:proto,md",
+			want:  []string{"api/service.proto", "docs/retry.md"},
+		},
+		{
+			query: "retry -type:code -type:documentation",
+			want:  []string{"api/service.proto", "pkg/client/client.yml"},
+		},
+		{
+			query: "retry path:pkg/client ext:go",
+			want:  []string{"pkg/client/client.go"},
+		},
+		{
+			query: "sym:New* pkg:server",
+			want:  []string{"pkg/server/server.go"},
+		},
+		{
+			query: `sym:"NewClient"`,
+			want:  []string{"pkg/client/client.go"},
+		},
+		{
+			query: "pkg:client",
+			want:  []string{"pkg/client/client.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			response, err := s.Search(context.Background(), tt.query, SearchOptions{Sort: "path"})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			var paths []string
+			for _, result := range response.Results {
+				if !slices.Contains(paths, result.Path) {
+					paths = append(paths, result.Path)
+				}
+			}
+			if !slices.Equal(paths, tt.want) {
+				t.Errorf("Search() paths = %v, want %v", paths, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package kwb
+
+import (
+	"bytes"
+	"math"
+	"path/filepath"
+	"regexp"
+)
+
+// Default deny-list of file name patterns which are never indexed.
+var defaultDenyFiles = []string{
+	".env",
+	".env.*",
+	"*.pem",
+	"*.key",
+	"*.p12",
+	"*.pfx",
+	"id_rsa*",
+	"id_ecdsa*",
+	"id_ed25519*",
+	".netrc",
+	".npmrc",
+	".pypirc",
+	"credentials.json",
+	"*.tfstate",
+}
+
+const redactedPlaceholder = "[REDACTED]"
+
+// Values of assignments are only redacted if they look random enough,
+// minimum entropy is in bits per character.
+const (
+	minSecretLength  = 16
+	minSecretEntropy = 3.5
+)
+
+type secretRule struct {
+	re *regexp.Regexp
+	// group is the submatch to redact, 0 for the whole match.
+	// If it did not participate in the match, the first following one which did is redacted.
+	group int
+	// highEntropy requires redacted value to look random
+	highEntropy bool
+}
+
+var secretRules = []secretRule{
+	// Private key blocks, e.g. PEM encoded RSA keys
+	{
+		re: regexp.MustCompile(
+			`-----BEGIN[A-Z ]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END[A-Z ]*PRIVATE KEY( BLOCK)?-----`,
+		),
+	},
+	// AWS access key ids
+	{
+		re: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`),
+	},
+	// GitHub personal access, OAuth, app and refresh tokens
+	{
+		re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`),
+	},
+	// Values assigned to keys, tokens, passwords and such,
+	// quoted values up to the closing quote, unquoted ones up to the end of the token
+	{
+		re: regexp.MustCompile(
+			`(?i)[\w.-]*(?:key|secret|token|passw(?:or)?d|pwd|credential|auth)[\w.-]*["']?\s*(?::=|[:=])\s*` +
+				`(?:"([^"\n]{16,})"|'([^'\n]{16,})'|([^\s"'\x60,;()\[\]{}<>]{16,}))`,
+		),
+		group:       1,
+		highEntropy: true,
+	},
+}
+
+// isDeniedFile reports whether file name matches any of deny-list patterns.
+func isDeniedFile(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSecrets masks secrets found in content and returns the number of masked values.
+// Line breaks inside secrets are kept, so line numbers of the rest of content do not change.
+func redactSecrets(content []byte) ([]byte, int) {
+	total := 0
+	for _, rule := range secretRules {
+		matches := rule.re.FindAllSubmatchIndex(content, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		var out bytes.Buffer
+		last := 0
+		for _, m := range matches {
+			group := rule.group
+			for group > 0 && group < len(m)/2-1 && m[2*group] < 0 {
+				group++
+			}
+			start, end := m[2*group], m[2*group+1]
+			if start < 0 {
+				continue
+			}
+			value := content[start:end]
+			if rule.highEntropy && !looksRandom(value) {
+				continue
+			}
+			out.Write(content[last:start])
+			out.WriteString(redactedPlaceholder)
+			out.Write(bytes.Repeat([]byte{'\n'}, bytes.Count(value, []byte{'\n'})))
+			last = end
+			total++
+		}
+		out.Write(content[last:])
+		content = out.Bytes()
+	}
+	return content, total
+}
+
+// looksRandom reports whether value is long and random enough to be a secret.
+// Digits are required, so identifiers and expressions assigned in code are not taken for secrets.
+func looksRandom(value []byte) bool {
+	if len(value) < minSecretLength || !bytes.ContainsAny(value, "0123456789") {
+		return false
+	}
+	return shannonEntropy(value) >= minSecretEntropy
+}
+
+// shannonEntropy returns entropy of value in bits per byte.
+func shannonEntropy(value []byte) float64 {
+	var counts [256]int
+	for _, b := range value {
+		counts[b]++
+	}
+	entropy := 0.0
+	n := float64(len(value))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
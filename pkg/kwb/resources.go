@@ -0,0 +1,225 @@
+package kwb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	fileURIPrefix    = "kwb://file/"
+	fileURITemplate  = "kwb://file/{+path}"
+	resourcePageSize = 100
+
+	// generationPollInterval is how often index path is checked for generations
+	// published by builds of other processes.
+	generationPollInterval = 5 * time.Second
+)
+
+// resourceSubscriptions tracks resources clients subscribed to, by session.
+type resourceSubscriptions struct {
+	mu       sync.Mutex
+	sessions map[string]map[string]bool // uris by session id
+}
+
+func newResourceSubscriptions() *resourceSubscriptions {
+	return &resourceSubscriptions{
+		sessions: make(map[string]map[string]bool),
+	}
+}
+
+// hooks returns server hooks recording subscribe and unsubscribe requests,
+// subscriptions of a session are dropped once it is closed.
+func (r *resourceSubscriptions) hooks() *server.Hooks {
+	hooks := &server.Hooks{}
+	hooks.AddAfterSubscribe(func(ctx context.Context, _ any, request *mcp.SubscribeRequest, _ *mcp.EmptyResult) {
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			r.subscribe(session.SessionID(), request.Params.URI)
+		}
+	})
+	hooks.AddAfterUnsubscribe(func(ctx context.Context, _ any, request *mcp.UnsubscribeRequest, _ *mcp.EmptyResult) {
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			r.unsubscribe(session.SessionID(), request.Params.URI)
+		}
+	})
+	hooks.AddOnUnregisterSession(func(_ context.Context, session server.ClientSession) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.sessions, session.SessionID())
+	})
+	return hooks
+}
+
+func (r *resourceSubscriptions) subscribe(sessionID, uri string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	uris, ok := r.sessions[sessionID]
+	if !ok {
+		uris = make(map[string]bool)
+		r.sessions[sessionID] = uris
+	}
+	uris[uri] = true
+}
+
+func (r *resourceSubscriptions) unsubscribe(sessionID, uri string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions[sessionID], uri)
+}
+
+// subscribers returns ids of sessions subscribed to uri.
+func (r *resourceSubscriptions) subscribers(uri string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []string
+	for id, uris := range r.sessions {
+		if uris[uri] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// fileURI returns resource URI of an indexed file.
+func fileURI(path string) string {
+	return fileURIPrefix + (&url.URL{Path: path}).EscapedPath()
+}
+
+// pathFromURI returns indexed file path addressed by resource URI.
+func pathFromURI(uri string) (string, error) {
+	escaped, ok := strings.CutPrefix(uri, fileURIPrefix)
+	if !ok {
+		return "", fmt.Errorf("unsupported resource uri: %s", uri)
+	}
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", fmt.Errorf("invalid resource uri %s: %w", uri, err)
+	}
+	return path, nil
+}
+
+func newFileResource(path string) mcp.Resource {
+	return mcp.NewResource(fileURI(path), path,
+		mcp.WithResourceDescription(fmt.Sprintf("Indexed %s file", getFileType(path))),
+		mcp.WithMIMEType(getMIMEType(path)),
+	)
+}
+
+// addResources registers every indexed file as a resource and keeps
+// the list in sync with index updates, including generations published by other processes.
+// Clients subscribed to a re-indexed file are notified of its update.
+func (s *MCPServer) addResources(
+	ctx context.Context,
+	mcpServer *server.MCPServer,
+	subscriptions *resourceSubscriptions,
+) error {
+	mcpServer.AddResourceTemplate(
+		mcp.NewResourceTemplate(fileURITemplate, "file",
+			mcp.WithTemplateDescription("Content of an indexed file"),
+		),
+		s.readResourceHandler,
+	)
+
+	var resources []server.ServerResource
+	opts := ListOptions{Limit: defaultListLimit}
+	for {
+		list, err := s.service.ListFiles(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("listing files: %w", err)
+		}
+		for _, path := range list.Files {
+			resources = append(resources, server.ServerResource{
+				Resource: newFileResource(path),
+				Handler:  s.readResourceHandler,
+			})
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		opts.Cursor = list.NextCursor
+	}
+	mcpServer.AddResources(resources...)
+
+	s.service.OnIndexChange(func(change IndexChange) {
+		if len(change.Removed) > 0 {
+			uris := make([]string, 0, len(change.Removed))
+			for _, path := range change.Removed {
+				uris = append(uris, fileURI(path))
+			}
+			mcpServer.DeleteResources(uris...)
+		}
+		if len(change.Added) > 0 {
+			added := make([]server.ServerResource, 0, len(change.Added))
+			for _, path := range change.Added {
+				added = append(added, server.ServerResource{
+					Resource: newFileResource(path),
+					Handler:  s.readResourceHandler,
+				})
+			}
+			mcpServer.AddResources(added...)
+		}
+		for _, path := range change.Updated {
+			uri := fileURI(path)
+			for _, sessionID := range subscriptions.subscribers(uri) {
+				err := mcpServer.SendNotificationToSpecificClient(sessionID, mcp.MethodNotificationResourceUpdated,
+					map[string]any{"uri": uri})
+				if err != nil {
+					s.service.logger.Debug("failed to notify subscriber",
+						slog.String("session", sessionID),
+						slog.String("error", err.Error()))
+				}
+			}
+		}
+	})
+
+	go s.followGenerations(ctx)
+
+	s.service.logger.InfoContext(ctx, "Registered file resources", slog.Int("count", len(resources)))
+
+	return nil
+}
+
+// followGenerations reopens index whenever a build publishes new generation,
+// which announces files changed by the build, until ctx is cancelled.
+func (s *MCPServer) followGenerations(ctx context.Context) {
+	ticker := time.NewTicker(generationPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.service.indexManager.GetIndex(); err != nil {
+				s.service.logger.Warn("failed to reopen index", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+func (s *MCPServer) readResourceHandler(
+	ctx context.Context,
+	request mcp.ReadResourceRequest,
+) ([]mcp.ResourceContents, error) {
+	path, err := pathFromURI(request.Params.URI)
+	if err != nil {
+		return nil, err
+	}
+	content, err := s.service.GetFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{
+			URI:      request.Params.URI,
+			MIMEType: getMIMEType(path),
+			Text:     content,
+		},
+	}, nil
+}
@@ -0,0 +1,23 @@
+package kwb
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResourceSubscriptions(t *testing.T) {
+	r := newResourceSubscriptions()
+	uri := fileURI("pkg/kwb/index.go")
+
+	r.subscribe("a", uri)
+	r.subscribe("b", uri)
+	r.subscribe("b", fileURI("README.md"))
+	r.unsubscribe("a", uri)
+
+	if got := r.subscribers(uri); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("subscribers() = %v, want [b]", got)
+	}
+	if got := r.subscribers(fileURI("go.mod")); len(got) != 0 {
+		t.Errorf("subscribers() of not subscribed uri = %v, want none", got)
+	}
+}
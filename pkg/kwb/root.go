@@ -0,0 +1,115 @@
+package kwb
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Root is a directory indexed under an alias.
+// Ids of files of aliased roots are namespaced by the alias, e.g. "api:cmd/main.go",
+// while paths are always relative to the root.
+type Root struct {
+	Alias string // empty only for the single root of an index
+	Path  string
+
+	// Set for roots of dependency modules, which are aliased by module@version
+	module  string
+	version string
+}
+
+// ParseRoots parses roots given as "path" or "alias=path".
+// Single root needs no alias, when there are several each of them is named
+// after its directory unless aliased explicitly.
+// Aliases must be unique and roots must not contain each other.
+func ParseRoots(specs []string) ([]Root, error) {
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("at least one root is required")
+	}
+
+	roots := make([]Root, 0, len(specs))
+	dirs := make([]string, 0, len(specs))
+	aliases := make(map[string]bool)
+	for _, spec := range specs {
+		alias, path, aliased := strings.Cut(spec, "=")
+		if !aliased {
+			alias, path = "", spec
+		}
+		if path == "" {
+			return nil, fmt.Errorf("root %q has no path", spec)
+		}
+		dir, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("resolving root %s: %w", path, err)
+		}
+
+		if !aliased && len(specs) > 1 {
+			alias = filepath.Base(dir)
+		}
+		if aliased && alias == "" {
+			return nil, fmt.Errorf("root %q has empty alias", spec)
+		}
+		if strings.ContainsAny(alias, ":/\\ \t") {
+			return nil, fmt.Errorf("invalid root alias %q: must not contain ':', slashes or spaces", alias)
+		}
+		if aliases[alias] {
+			return nil, fmt.Errorf("duplicate root alias %q, name roots with alias=path", alias)
+		}
+		aliases[alias] = true
+
+		for i, other := range dirs {
+			if isWithinDir(other, dir) || isWithinDir(dir, other) {
+				return nil, fmt.Errorf("roots %s and %s overlap", roots[i].Path, path)
+			}
+		}
+		dirs = append(dirs, dir)
+
+		roots = append(roots, Root{Alias: alias, Path: path})
+	}
+	return roots, nil
+}
+
+func (r Root) String() string {
+	if r.Alias == "" {
+		return r.Path
+	}
+	return r.Alias + "=" + r.Path
+}
+
+// relPath returns slash separated path of a file relative to root.
+func (r Root) relPath(path string) (string, error) {
+	dir, err := filepath.Abs(r.Path)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if !isWithinDir(dir, abs) {
+		return "", fmt.Errorf("%s is outside of root %s", path, r.Path)
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// rootOf returns root which contains path.
+func rootOf(roots []Root, path string) (Root, bool) {
+	for _, root := range roots {
+		if _, err := root.relPath(path); err == nil {
+			return root, true
+		}
+	}
+	return Root{}, false
+}
+
+// fileID returns id of a file of repo, path is relative to root of the repo.
+func fileID(repo, path string) string {
+	if repo == "" {
+		return path
+	}
+	return repo + ":" + path
+}
@@ -1,47 +1,295 @@
 package kwb
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
 	"github.com/blevesearch/bleve/v2/search/query"
 )
 
 type SearchResult struct {
-	Path    string
-	Score   float64
-	Type    string
-	Preview string
+	Repo    string  `json:"repo,omitempty"` // alias of the root, path is relative to it
+	Path    string  `json:"path"`
+	Score   float64 `json:"score"`
+	Type    string  `json:"type"`
+	Preview string  `json:"preview,omitempty"`
+
+	// Kind of matched document: file, chunk or symbol
+	Kind string `json:"kind"`
+
+	// Line range of matched document, and position of the first match within it
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	LineText  string `json:"line_text,omitempty"` // full text of the matched line
+
+	// Declaration details, set when result is a symbol rather than a whole file
+	Symbol     string `json:"symbol,omitempty"`
+	SymbolKind string `json:"symbol_kind,omitempty"`
+	Signature  string `json:"signature,omitempty"`
+
+	// Heading path and anchor, set when result is a section of markdown file
+	Section string `json:"section,omitempty"`
+	Anchor  string `json:"anchor,omitempty"`
+
+	// Module and its version, set when result comes from a dependency
+	Module        string `json:"module,omitempty"`
+	ModuleVersion string `json:"module_version,omitempty"`
+
+	id string // document id, used to merge results of different searches
+}
+
+// FileID returns id of the matched file, its path prefixed with repo if it belongs to an aliased root.
+func (r SearchResult) FileID() string {
+	return fileID(r.Repo, r.Path)
+}
+
+// Location returns "path:line" reference pointing at the match.
+// Path is prefixed with repo, if result belongs to an aliased root.
+func (r SearchResult) Location() string {
+	path := r.FileID()
+	if r.Line > 0 {
+		return fmt.Sprintf("%s:%d", path, r.Line)
+	}
+	if r.StartLine > 0 {
+		return fmt.Sprintf("%s:%d", path, r.StartLine)
+	}
+	return path
+}
+
+// SearchResponse is a single page of search results.
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+	Total   uint64         `json:"total"` // number of matching documents across all pages
+	Offset  int            `json:"offset"`
+	Facets  []Facet        `json:"facets,omitempty"` // set if facets were requested
+}
+
+// HasMore reports whether there are results beyond this page.
+func (r *SearchResponse) HasMore() bool {
+	return uint64(r.Offset+len(r.Results)) < r.Total
+}
+
+// NextOffset returns offset of the next page.
+func (r *SearchResponse) NextOffset() int {
+	return r.Offset + len(r.Results)
+}
+
+// Facet fields which can be requested with search.
+const (
+	FacetType = "type"
+	FacetDir  = "dir"
+)
+
+// facetSize is the maximum number of terms returned per facet.
+const facetSize = 10
+
+// facetHitLimit is the maximum number of hits scanned to count files for facets.
+const facetHitLimit = 10000
+
+// Facet holds counts of matching files per distinct value of a field, across all pages.
+// File is counted once, no matter how many of its chunks, sections or symbols match.
+type Facet struct {
+	Field string      `json:"field"`
+	Terms []FacetTerm `json:"terms"`
+	Other int         `json:"other,omitempty"` // files with values beyond returned terms
+}
+
+type FacetTerm struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+// FileResults holds search results which belong to the same file.
+type FileResults struct {
+	Repo    string         `json:"repo,omitempty"`
+	Path    string         `json:"path"`
+	Type    string         `json:"type"`
+	Score   float64        `json:"score"` // best score among results
+	Results []SearchResult `json:"results"`
+}
+
+// Location returns path of the file, prefixed with repo if it belongs to an aliased root.
+func (g FileResults) Location() string {
+	return fileID(g.Repo, g.Path)
+}
+
+// GroupByFile groups results per file, preserving order of first appearance.
+// Overlapping chunks of the same file are collapsed into the best scoring one.
+func GroupByFile(results []SearchResult) []FileResults {
+	groups := make([]FileResults, 0)
+	positions := make(map[string]int)
+	for _, r := range results {
+		id := fileID(r.Repo, r.Path)
+		i, ok := positions[id]
+		if !ok {
+			i = len(groups)
+			positions[id] = i
+			groups = append(groups, FileResults{Repo: r.Repo, Path: r.Path, Type: r.Type})
+		}
+		g := &groups[i]
+		if r.Score > g.Score {
+			g.Score = r.Score
+		}
+		if r.Kind == kindChunk && overlapsAny(g.Results, r) {
+			continue
+		}
+		g.Results = append(g.Results, r)
+	}
+	return groups
+}
+
+func overlapsAny(results []SearchResult, r SearchResult) bool {
+	for _, other := range results {
+		if other.Kind == kindChunk && r.StartLine <= other.EndLine && other.StartLine <= r.EndLine {
+			return true
+		}
+	}
+	return false
 }
 
 type searcher struct {
 	settings     *Settings
 	indexManager *indexManager
+	embedder     Embedder // nil if semantic search is disabled
+
+	vectorsMu sync.Mutex
+	vectors   *vectorSet // loaded on first semantic search
 }
 
-func newSearcher(settings *Settings, indexManager *indexManager) *searcher {
-	return &searcher{
+func newSearcher(settings *Settings, indexManager *indexManager, embedder Embedder) *searcher {
+	s := &searcher{
 		settings:     settings,
 		indexManager: indexManager,
+		embedder:     embedder,
 	}
+	indexManager.onChange(func(IndexChange) {
+		s.resetVectors()
+	})
+	return s
+}
+
+// SearchTimeoutError is returned when search does not complete within configured timeout.
+type SearchTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *SearchTimeoutError) Error() string {
+	return fmt.Sprintf("search timed out after %s", e.Timeout)
 }
 
-func (s *searcher) Search(queryStr string, limit int) ([]SearchResult, error) {
+func (e *SearchTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// keywordFields are not analyzed, fuzziness is never applied to them.
+var keywordFields = map[string]bool{
+	"path":        true,
+	"repo":        true,
+	"type":        true,
+	"kind":        true,
+	"package":     true,
+	"receiver":    true,
+	"symbol_kind": true,
+}
+
+// Search modes.
+const (
+	SearchModeKeyword  = "keyword"
+	SearchModeSemantic = "semantic"
+	SearchModeHybrid   = "hybrid"
+)
+
+func (s *searcher) Search(ctx context.Context, queryStr string, opts SearchOptions) (*SearchResponse, error) {
 	index, err := s.indexManager.GetIndex()
 	if err != nil {
 		return nil, fmt.Errorf("getting index: %w", err)
 	}
 
+	limit := opts.Limit
 	if limit <= 0 {
 		limit = s.settings.SearchLimit
 	}
+	if opts.Offset < 0 {
+		return nil, fmt.Errorf("offset cannot be negative")
+	}
+
+	if s.settings.SearchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.settings.SearchTimeout)
+		defer cancel()
+	}
+
+	var response *SearchResponse
+	switch opts.Mode {
+	case "", SearchModeKeyword:
+		response, err = s.keywordSearch(ctx, index, queryStr, opts, limit)
+	case SearchModeSemantic:
+		response, err = s.semanticSearch(ctx, index, queryStr, opts, limit)
+	case SearchModeHybrid:
+		response, err = s.hybridSearch(ctx, index, queryStr, opts, limit)
+	default:
+		return nil, fmt.Errorf("invalid search mode: %s (must be '%s', '%s' or '%s')",
+			opts.Mode, SearchModeKeyword, SearchModeSemantic, SearchModeHybrid)
+	}
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, &SearchTimeoutError{Timeout: s.settings.SearchTimeout}
+		}
+		return nil, err
+	}
+	return response, nil
+}
+
+// resultFields are loaded for every hit to build search results.
+var resultFields = []string{
+	"repo", "path", "type", "kind", "content", "name", "symbol_kind", "signature", "start_line", "end_line",
+	"module", "module_version", "section", "anchor",
+}
+
+func (s *searcher) keywordSearch(
+	ctx context.Context,
+	index bleve.Index,
+	queryStr string,
+	opts SearchOptions,
+	limit int,
+) (*SearchResponse, error) {
+	parsed, err := parseQuery(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	parsed.excludeHistory(opts)
+	bleveQuery, err := parsed.keywordQuery(s.settings.SearchFuzziness)
+	if err != nil {
+		return nil, err
+	}
+
+	bleveQuery, err = opts.withFilters(bleveQuery)
+	if err != nil {
+		return nil, err
+	}
 
-	// Build query - use query string for flexibility
-	bleveQuery := bleve.NewQueryStringQuery(queryStr)
+	sortOrder, err := opts.sortOrder()
+	if err != nil {
+		return nil, err
+	}
 
-	searchRequest := bleve.NewSearchRequestOptions(bleveQuery, limit, 0, false)
-	searchRequest.Fields = []string{"path", "type"}
+	searchRequest := bleve.NewSearchRequestOptions(bleveQuery, limit, opts.Offset, false)
+	if sortOrder != nil {
+		searchRequest.SortBy(sortOrder)
+	}
+	searchRequest.Fields = resultFields
+	// Locations are used to find the line of the first match
+	searchRequest.IncludeLocations = true
 
 	// Configure highlighting
 	highlight := bleve.NewHighlight()
@@ -51,26 +299,34 @@ func (s *searcher) Search(queryStr string, limit int) ([]SearchResult, error) {
 	// Default highlight style works well for ANSI
 	searchRequest.Highlight = highlight
 
-	result, err := index.Search(searchRequest)
+	result, err := index.SearchInContext(ctx, searchRequest)
 	if err != nil {
 		return nil, fmt.Errorf("search error: %w", err)
 	}
 
 	results := make([]SearchResult, 0, len(result.Hits))
 	for _, hit := range result.Hits {
-		sr := SearchResult{
-			Path:  hit.ID,
-			Score: hit.Score,
-		}
+		sr := hitResult(hit)
 
-		if pathField, ok := hit.Fields["path"].(string); ok {
-			sr.Path = pathField
-		}
-		if typeField, ok := hit.Fields["type"].(string); ok {
-			sr.Type = typeField
+		if content, ok := hit.Fields["content"].(string); ok && sr.StartLine > 0 {
+			offset, found := bestMatchOffset(content, hit.Locations["content"])
+			if found && int(offset) <= len(content) {
+				before := content[:offset]
+				sr.Line = sr.StartLine + strings.Count(before, "\n")
+				lineStart := strings.LastIndex(before, "\n") + 1
+				sr.Column = int(offset) - lineStart + 1
+				lineEnd := strings.IndexByte(content[lineStart:], '\n')
+				if lineEnd < 0 {
+					lineEnd = len(content) - lineStart
+				}
+				sr.LineText = strings.TrimRight(content[lineStart:lineStart+lineEnd], "\r")
+			}
 		}
 
-		if len(hit.Fragments) > 0 {
+		// Content shows context of the match, other fields only repeat metadata
+		if fragments := hit.Fragments["content"]; len(fragments) > 0 {
+			sr.Preview = fragments[0]
+		} else {
 			for _, fragments := range hit.Fragments {
 				if len(fragments) > 0 {
 					sr.Preview = fragments[0]
@@ -82,44 +338,300 @@ func (s *searcher) Search(queryStr string, limit int) ([]SearchResult, error) {
 		results = append(results, sr)
 	}
 
-	return results, nil
+	response := &SearchResponse{
+		Results: results,
+		Total:   result.Total,
+		Offset:  opts.Offset,
+	}
+	if opts.Facets {
+		response.Facets, err = fileFacets(ctx, index, bleveQuery, result.Total)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+// fileFacets counts distinct files among first facetHitLimit hits of q per type and top-level directory.
+func fileFacets(ctx context.Context, index bleve.Index, q query.Query, total uint64) ([]Facet, error) {
+	request := bleve.NewSearchRequestOptions(q, int(min(total, facetHitLimit)), 0, false)
+	request.Fields = []string{"repo", "path", FacetType, FacetDir}
+	result, err := index.SearchInContext(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("facet search error: %w", err)
+	}
+
+	fields := []string{FacetType, FacetDir}
+	counts := make(map[string]map[string]int, len(fields))
+	for _, field := range fields {
+		counts[field] = make(map[string]int)
+	}
+	seen := make(map[string]bool)
+	for _, hit := range result.Hits {
+		repo, _ := hit.Fields["repo"].(string)
+		path, _ := hit.Fields["path"].(string)
+		file := fileID(repo, path)
+		if path == "" {
+			file = hit.ID
+		}
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		for _, field := range fields {
+			if value, ok := hit.Fields[field].(string); ok {
+				counts[field][value]++
+			}
+		}
+	}
+
+	facets := make([]Facet, 0, len(fields))
+	for _, field := range fields {
+		facet := Facet{Field: field}
+		for value, count := range counts[field] {
+			facet.Terms = append(facet.Terms, FacetTerm{Term: value, Count: count})
+		}
+		slices.SortFunc(facet.Terms, func(a, b FacetTerm) int {
+			if a.Count != b.Count {
+				return b.Count - a.Count
+			}
+			return strings.Compare(a.Term, b.Term)
+		})
+		if len(facet.Terms) > facetSize {
+			for _, term := range facet.Terms[facetSize:] {
+				facet.Other += term.Count
+			}
+			facet.Terms = facet.Terms[:facetSize]
+		}
+		facets = append(facets, facet)
+	}
+	return facets, nil
+}
+
+// hitResult converts stored fields of a hit into search result.
+func hitResult(hit *search.DocumentMatch) SearchResult {
+	sr := SearchResult{
+		Path:  hit.ID,
+		Score: hit.Score,
+		id:    hit.ID,
+	}
+
+	if repoField, ok := hit.Fields["repo"].(string); ok {
+		sr.Repo = repoField
+	}
+	if pathField, ok := hit.Fields["path"].(string); ok {
+		sr.Path = pathField
+	}
+	if sectionField, ok := hit.Fields["section"].(string); ok {
+		sr.Section = sectionField
+	}
+	if anchorField, ok := hit.Fields["anchor"].(string); ok {
+		sr.Anchor = anchorField
+	}
+	if moduleField, ok := hit.Fields["module"].(string); ok {
+		sr.Module = moduleField
+	}
+	if versionField, ok := hit.Fields["module_version"].(string); ok {
+		sr.ModuleVersion = versionField
+	}
+	if typeField, ok := hit.Fields["type"].(string); ok {
+		sr.Type = typeField
+	}
+	if kindField, ok := hit.Fields["kind"].(string); ok {
+		sr.Kind = kindField
+	}
+	if nameField, ok := hit.Fields["name"].(string); ok {
+		sr.Symbol = nameField
+	}
+	if symbolKindField, ok := hit.Fields["symbol_kind"].(string); ok {
+		sr.SymbolKind = symbolKindField
+	}
+	if signatureField, ok := hit.Fields["signature"].(string); ok {
+		sr.Signature = signatureField
+	}
+	if startField, ok := hit.Fields["start_line"].(float64); ok {
+		sr.StartLine = int(startField)
+	}
+	if endField, ok := hit.Fields["end_line"].(float64); ok {
+		sr.EndLine = int(endField)
+	}
+
+	return sr
 }
 
+// applyFuzziness sets edit distance on plain term queries of parsed query string.
+// Terms which already have explicit fuzziness, or target keyword fields, are left intact.
+func applyFuzziness(q query.Query, fuzziness int) {
+	switch q := q.(type) {
+	case *query.BooleanQuery:
+		for _, sub := range []query.Query{q.Must, q.Should, q.MustNot} {
+			if sub != nil {
+				applyFuzziness(sub, fuzziness)
+			}
+		}
+	case *query.ConjunctionQuery:
+		for _, sub := range q.Conjuncts {
+			applyFuzziness(sub, fuzziness)
+		}
+	case *query.DisjunctionQuery:
+		for _, sub := range q.Disjuncts {
+			applyFuzziness(sub, fuzziness)
+		}
+	case *query.MatchQuery:
+		if q.Fuzziness == 0 && !keywordFields[q.FieldVal] {
+			q.SetFuzziness(fuzziness)
+		}
+	}
+}
+
+// bestMatchOffset returns byte offset of the match on the line where most distinct query terms occur,
+// earliest such line wins. Within the line longer terms are preferred, so the whole identifier
+// is reported rather than one of its parts.
+func bestMatchOffset(content string, locations search.TermLocationMap) (uint64, bool) {
+	var newlines []int
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			newlines = append(newlines, i)
+		}
+	}
+	lineOf := func(offset uint64) int {
+		line, _ := slices.BinarySearch(newlines, int(offset))
+		return line
+	}
+
+	lineTerms := make(map[int]int)
+	for _, locs := range locations {
+		seen := make(map[int]bool)
+		for _, loc := range locs {
+			if line := lineOf(loc.Start); !seen[line] {
+				seen[line] = true
+				lineTerms[line]++
+			}
+		}
+	}
+
+	var (
+		best      uint64
+		bestLine  int
+		bestTerms int
+		bestLen   int
+		found     bool
+	)
+	for term, locs := range locations {
+		for _, loc := range locs {
+			line := lineOf(loc.Start)
+			terms := lineTerms[line]
+			better := !found ||
+				terms > bestTerms ||
+				terms == bestTerms && line < bestLine ||
+				terms == bestTerms && line == bestLine && len(term) > bestLen ||
+				terms == bestTerms && line == bestLine && len(term) == bestLen && loc.Start < best
+			if better {
+				best, bestLine, bestTerms, bestLen, found = loc.Start, line, terms, len(term), true
+			}
+		}
+	}
+	return best, found
+}
+
+// GetFile returns content of an indexed file, secrets are masked the same way as in the index.
+// Files outside of indexed root are never served.
 func (s *searcher) GetFile(path string) (string, error) {
-	content, err := os.ReadFile(path)
+	resolved, err := s.resolveFile(path)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(resolved)
 	if err != nil {
 		return "", fmt.Errorf("reading file %s: %w", path, err)
 	}
+	content, _ = redactSecrets(content)
 	return string(content), nil
 }
 
-func (s *searcher) ListFiles(fileType string) ([]string, error) {
+// ListOptions selects a page of indexed files.
+// Pages can be addressed either by offset, or by cursor returned with previous page.
+type ListOptions struct {
+	Type   string // document type, empty for all
+	Repo   string // alias of indexed root, empty for all
+	Offset int
+	Cursor string
+	Limit  int // 0 = default list limit
+}
+
+// FileList is a single page of indexed files, ordered by path.
+type FileList struct {
+	Files      []string `json:"files"`
+	Total      uint64   `json:"total"`                 // number of matching files across all pages
+	Offset     int      `json:"offset"`                // offset of the page, -1 when cursor was used
+	NextCursor string   `json:"next_cursor,omitempty"` // empty if this is the last page
+}
+
+const defaultListLimit = 1000
+
+func (s *searcher) ListFiles(ctx context.Context, opts ListOptions) (*FileList, error) {
 	index, err := s.indexManager.GetIndex()
 	if err != nil {
 		return nil, fmt.Errorf("getting index: %w", err)
 	}
 
-	var q query.Query
-	if fileType != "" {
-		termQuery := bleve.NewTermQuery(fileType)
-		termQuery.SetField("type")
-		q = termQuery
-	} else {
-		q = bleve.NewMatchAllQuery()
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if opts.Offset < 0 {
+		return nil, fmt.Errorf("offset cannot be negative")
 	}
 
-	searchRequest := bleve.NewSearchRequestOptions(q, 1000, 0, false)
-	searchRequest.Fields = []string{"path", "type"}
+	kindQuery := bleve.NewTermQuery(kindFile)
+	kindQuery.SetField("kind")
 
-	result, err := index.Search(searchRequest)
+	conjuncts := []query.Query{kindQuery}
+	if opts.Type != "" {
+		conjuncts = append(conjuncts, fieldTermQuery("type", opts.Type))
+	}
+	if opts.Repo != "" {
+		conjuncts = append(conjuncts, fieldTermQuery("repo", opts.Repo))
+	}
+	var q query.Query = kindQuery
+	if len(conjuncts) > 1 {
+		q = bleve.NewConjunctionQuery(conjuncts...)
+	}
+
+	// One extra hit tells whether next page exists
+	searchRequest := bleve.NewSearchRequestOptions(q, limit+1, opts.Offset, false)
+	searchRequest.SortBy([]string{"_id"})
+	if opts.Cursor != "" {
+		searchRequest.From = 0
+		searchRequest.SearchAfter = []string{opts.Cursor}
+	}
+
+	result, err := index.SearchInContext(ctx, searchRequest)
 	if err != nil {
 		return nil, fmt.Errorf("search error: %w", err)
 	}
 
-	files := make([]string, 0, len(result.Hits))
-	for _, hit := range result.Hits {
-		files = append(files, hit.ID)
+	hits := result.Hits
+	more := len(hits) > limit
+	if more {
+		hits = hits[:limit]
+	}
+
+	list := &FileList{
+		Files:  make([]string, 0, len(hits)),
+		Total:  result.Total,
+		Offset: opts.Offset,
+	}
+	for _, hit := range hits {
+		list.Files = append(list.Files, hit.ID)
+	}
+	if more {
+		list.NextCursor = list.Files[len(list.Files)-1]
+	}
+	if opts.Cursor != "" {
+		list.Offset = -1
 	}
 
-	return files, nil
+	return list, nil
 }
@@ -0,0 +1,350 @@
+package kwb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// newTestSearcher indexes files, given by path relative to root, and returns searcher over them.
+func newTestSearcher(t *testing.T, files map[string]string) *searcher {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	settings := &Settings{
+		IndexPath:      filepath.Join(t.TempDir(), "kb.index"),
+		MaxFileSize:    1024 * 1024,
+		BatchSize:      100,
+		IndexType:      "scorch",
+		ChunkLines:     80,
+		ChunkOverlap:   10,
+		SearchLimit:    20,
+		HighlightStyle: "ansi",
+	}
+	m := newIndexManager(settings, "test", nil, slog.New(slog.DiscardHandler))
+	if err := m.BuildIndex([]Root{{Path: root}}); err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+	t.Cleanup(func() { _ = m.CloseIndex() })
+	return newSearcher(settings, m, nil)
+}
+
+func TestSearch_ExactIdentifierRanksFirst(t *testing.T) {
+	files := map[string]string{
+		"pkg/kwb/manager.go": "package kwb\n\n" +
+			"// indexManager owns the index.\n" +
+			"type indexManager struct {\n" + strings.Repeat("\tsettings *Settings\n\tindex    Index\n", 20) + "}\n",
+	}
+	for i := 0; i < 15; i++ {
+		var uses strings.Builder
+		uses.WriteString("package kwb\n\n")
+		for j := 0; j < 10; j++ {
+			fmt.Fprintf(&uses, "func (m *indexManager) use%d() *indexManager {\n\treturn m\n}\n\n", j)
+		}
+		files[fmt.Sprintf("pkg/kwb/use%02d.go", i)] = uses.String()
+		files[fmt.Sprintf("docs/guide%02d.md", i)] = "# Guide\n\n" +
+			"The index is rebuilt by the index manager. Every index has a manager,\n" +
+			"ask the manager to refresh the index.\n"
+	}
+	s := newTestSearcher(t, files)
+
+	response, err := s.Search(context.Background(), "indexManager", SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(response.Results) == 0 {
+		t.Fatal("Search() returned no results")
+	}
+	if top := response.Results[0]; top.Path != "pkg/kwb/manager.go" || top.Kind != kindSymbol {
+		t.Errorf("top result = %s:%d (%s), want declaration in pkg/kwb/manager.go", top.Path, top.Line, top.Kind)
+	}
+}
+
+func TestBestMatchOffset(t *testing.T) {
+	content := "index := 1\n" +
+		"manager := 2\n" +
+		"m := indexManager{}\n"
+	at := func(offsets ...uint64) search.Locations {
+		var locs search.Locations
+		for _, offset := range offsets {
+			locs = append(locs, &search.Location{Start: offset})
+		}
+		return locs
+	}
+
+	tests := []struct {
+		name      string
+		locations search.TermLocationMap
+		want      uint64
+		found     bool
+	}{
+		{
+			name:      "no locations",
+			locations: search.TermLocationMap{},
+		},
+		{
+			name:      "single term",
+			locations: search.TermLocationMap{"manager": at(11)},
+			want:      11,
+			found:     true,
+		},
+		{
+			name: "line with all terms wins over earlier lines",
+			locations: search.TermLocationMap{
+				"index":        at(0, 29),
+				"manager":      at(11, 29),
+				"indexmanager": at(29),
+			},
+			want:  29,
+			found: true,
+		},
+		{
+			name: "earliest line wins on tie",
+			locations: search.TermLocationMap{
+				"index":   at(0),
+				"manager": at(11),
+			},
+			want:  0,
+			found: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := bestMatchOffset(content, tt.locations)
+			if got != tt.want || found != tt.found {
+				t.Errorf("bestMatchOffset() = %d, %v, want %d, %v", got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestSearch_FacetsCountFiles(t *testing.T) {
+	// Large file is split into chunks and symbols which all match
+	var large strings.Builder
+	large.WriteString("package kwb\n\n")
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&large, "func retry%d() {}\n\n", i)
+		large.WriteString(strings.Repeat("// retry later\n", 10))
+	}
+	s := newTestSearcher(t, map[string]string{
+		"pkg/kwb/large.go": large.String(),
+		"pkg/kwb/small.go": "package kwb\n\n// retry once\n",
+		"docs/retry.md":    "# Retry\n\nretry policy\n",
+	})
+
+	response, err := s.Search(context.Background(), "retry", SearchOptions{Facets: true})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if response.Total <= 3 {
+		t.Fatalf("Total = %d, want more documents than files", response.Total)
+	}
+	want := map[string]map[string]int{
+		FacetType: {"code": 2, "documentation": 1},
+		FacetDir:  {"pkg/kwb": 2, "docs": 1},
+	}
+	for _, facet := range response.Facets {
+		got := make(map[string]int)
+		for _, term := range facet.Terms {
+			got[term.Term] = term.Count
+		}
+		if !maps.Equal(got, want[facet.Field]) {
+			t.Errorf("facet %s = %v, want %v", facet.Field, got, want[facet.Field])
+		}
+	}
+	if len(response.Facets) != len(want) {
+		t.Errorf("got %d facets, want %d", len(response.Facets), len(want))
+	}
+}
+
+func TestApplyFuzziness(t *testing.T) {
+	tests := []struct {
+		query string
+		want  map[string]int // fuzziness by match term
+	}{
+		{query: "retry", want: map[string]int{"retry": 2}},
+		{query: "retry backoff", want: map[string]int{"retry": 2, "backoff": 2}},
+		{query: "+retry -backoff", want: map[string]int{"retry": 2, "backoff": 2}},
+		{query: "retry~1", want: map[string]int{"retry": 1}},
+		{query: "path:retry.go content:retry", want: map[string]int{"retry.go": 0, "retry": 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := bleve.NewQueryStringQuery(tt.query).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			applyFuzziness(q, 2)
+
+			got := make(map[string]int)
+			var collect func(q query.Query)
+			collect = func(q query.Query) {
+				switch q := q.(type) {
+				case *query.BooleanQuery:
+					for _, sub := range []query.Query{q.Must, q.Should, q.MustNot} {
+						if sub != nil {
+							collect(sub)
+						}
+					}
+				case *query.ConjunctionQuery:
+					for _, sub := range q.Conjuncts {
+						collect(sub)
+					}
+				case *query.DisjunctionQuery:
+					for _, sub := range q.Disjuncts {
+						collect(sub)
+					}
+				case *query.MatchQuery:
+					got[q.Match] = q.Fuzziness
+				}
+			}
+			collect(q)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("fuzziness = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearch_FuzzinessAndTimeout(t *testing.T) {
+	s := newTestSearcher(t, map[string]string{
+		"retry.go": "package retry\n\n// Backoff waits before the next attempt.\nfunc Backoff() {}\n",
+	})
+
+	s.settings.SearchFuzziness = 0
+	response, err := s.Search(context.Background(), "bakcoff", SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if response.Total != 0 {
+		t.Errorf("exact search for misspelled term found %d results", response.Total)
+	}
+
+	s.settings.SearchFuzziness = 2
+	response, err = s.Search(context.Background(), "bakcoff", SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if response.Total == 0 {
+		t.Error("fuzzy search for misspelled term found nothing")
+	}
+
+	// Deadline of the caller has already passed
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = s.Search(ctx, "backoff", SearchOptions{})
+	var timeoutErr *SearchTimeoutError
+	if !errors.As(err, &timeoutErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Search() error = %v, want SearchTimeoutError", err)
+	}
+}
+
+func TestSearch_Pagination(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 7; i++ {
+		files[fmt.Sprintf("f%d.go", i)] = "package f\n\n// retry\n"
+	}
+	s := newTestSearcher(t, files)
+
+	var paths []string
+	for offset := 0; ; {
+		response, err := s.Search(context.Background(), "retry",
+			SearchOptions{Offset: offset, Limit: 3, Sort: "path", Types: []string{"code"}})
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+		if response.Total != 7 {
+			t.Fatalf("Total = %d, want 7", response.Total)
+		}
+		for _, result := range response.Results {
+			paths = append(paths, result.Path)
+		}
+		if !response.HasMore() {
+			break
+		}
+		offset = response.NextOffset()
+	}
+	want := slices.Sorted(maps.Keys(files))
+	if !slices.Equal(paths, want) {
+		t.Errorf("pages returned %v, want %v", paths, want)
+	}
+
+	if _, err := s.Search(context.Background(), "retry", SearchOptions{Offset: -1}); err == nil {
+		t.Error("Search() with negative offset succeeded")
+	}
+}
+
+func TestListFiles_Pagination(t *testing.T) {
+	s := newTestSearcher(t, map[string]string{
+		"a.go":      "package a\n",
+		"b.go":      "package b\n",
+		"c.go":      "package c\n",
+		"docs/d.md": "# D\n",
+		"e.go":      "package e\n",
+	})
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want FileList
+	}{
+		{
+			name: "first page",
+			opts: ListOptions{Limit: 2},
+			want: FileList{Files: []string{"a.go", "b.go"}, Total: 5, NextCursor: "b.go"},
+		},
+		{
+			name: "offset",
+			opts: ListOptions{Offset: 2, Limit: 2},
+			want: FileList{Files: []string{"c.go", "docs/d.md"}, Total: 5, Offset: 2, NextCursor: "docs/d.md"},
+		},
+		{
+			name: "cursor",
+			opts: ListOptions{Cursor: "docs/d.md", Limit: 2},
+			want: FileList{Files: []string{"e.go"}, Total: 5, Offset: -1},
+		},
+		{
+			name: "last page",
+			opts: ListOptions{Offset: 3, Limit: 2},
+			want: FileList{Files: []string{"docs/d.md", "e.go"}, Total: 5, Offset: 3},
+		},
+		{
+			name: "type",
+			opts: ListOptions{Type: "documentation"},
+			want: FileList{Files: []string{"docs/d.md"}, Total: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ListFiles(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatalf("ListFiles() error = %v", err)
+			}
+			if !slices.Equal(got.Files, tt.want.Files) || got.Total != tt.want.Total ||
+				got.Offset != tt.want.Offset || got.NextCursor != tt.want.NextCursor {
+				t.Errorf("ListFiles() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package kwb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+const (
+	// hybridCandidates is the minimum number of results taken from each search before fusion.
+	hybridCandidates = 50
+	// rrfK dampens influence of top ranks in reciprocal rank fusion.
+	rrfK = 60
+)
+
+// semanticSearch ranks documents by similarity of their vectors to the query vector.
+func (s *searcher) semanticSearch(
+	ctx context.Context,
+	index bleve.Index,
+	queryStr string,
+	opts SearchOptions,
+	limit int,
+) (*SearchResponse, error) {
+	ranked, err := s.semanticRank(ctx, index, queryStr, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	page := pageOf(ranked, opts.Offset, limit)
+	ids := make([]string, 0, len(page))
+	for _, doc := range page {
+		ids = append(ids, doc.id)
+	}
+	found, err := fetchResults(ctx, index, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(page))
+	for _, doc := range page {
+		sr, ok := found[doc.id]
+		if !ok {
+			continue
+		}
+		sr.Score = doc.score
+		results = append(results, sr)
+	}
+
+	return &SearchResponse{
+		Results: results,
+		Total:   uint64(len(ranked)),
+		Offset:  opts.Offset,
+	}, nil
+}
+
+// hybridSearch fuses keyword and semantic rankings with reciprocal rank fusion,
+// documents found by both searches rank above ones found by only one of them.
+// Facets only count keyword hits.
+func (s *searcher) hybridSearch(
+	ctx context.Context,
+	index bleve.Index,
+	queryStr string,
+	opts SearchOptions,
+	limit int,
+) (*SearchResponse, error) {
+	if opts.Sort != "" && opts.Sort != "score" {
+		return nil, fmt.Errorf("sorting by %s is only supported in %s mode", opts.Sort, SearchModeKeyword)
+	}
+	candidates := max(opts.Offset+limit, hybridCandidates)
+
+	keywordOpts := opts
+	keywordOpts.Offset = 0
+	keyword, err := s.keywordSearch(ctx, index, queryStr, keywordOpts, candidates)
+	if err != nil {
+		return nil, err
+	}
+	semantic, err := s.semanticRank(ctx, index, queryStr, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(semantic) > candidates {
+		semantic = semantic[:candidates]
+	}
+
+	scores := make(map[string]float64)
+	found := make(map[string]SearchResult)
+	for rank, sr := range keyword.Results {
+		scores[sr.id] += 1 / float64(rrfK+rank+1)
+		found[sr.id] = sr
+	}
+	for rank, doc := range semantic {
+		scores[doc.id] += 1 / float64(rrfK+rank+1)
+	}
+
+	fused := make([]scoredID, 0, len(scores))
+	for id, score := range scores {
+		fused = append(fused, scoredID{id: id, score: score})
+	}
+	sortScored(fused)
+	set, err := s.loadVectors(index)
+	if err != nil {
+		return nil, err
+	}
+	set.projectFirst(fused)
+
+	page := pageOf(fused, opts.Offset, limit)
+	var missing []string
+	for _, doc := range page {
+		if _, ok := found[doc.id]; !ok {
+			missing = append(missing, doc.id)
+		}
+	}
+	fetched, err := fetchResults(ctx, index, missing)
+	if err != nil {
+		return nil, err
+	}
+	for id, sr := range fetched {
+		found[id] = sr
+	}
+
+	results := make([]SearchResult, 0, len(page))
+	for _, doc := range page {
+		sr, ok := found[doc.id]
+		if !ok {
+			continue
+		}
+		sr.Score = doc.score
+		results = append(results, sr)
+	}
+
+	return &SearchResponse{
+		Results: results,
+		Total:   uint64(len(fused)),
+		Offset:  opts.Offset,
+		Facets:  keyword.Facets,
+	}, nil
+}
+
+// semanticRank returns all documents matching filters of opts which are similar to query, best first.
+func (s *searcher) semanticRank(
+	ctx context.Context,
+	index bleve.Index,
+	queryStr string,
+	opts SearchOptions,
+) ([]scoredID, error) {
+	if s.embedder == nil {
+		return nil, fmt.Errorf("semantic search is disabled, no embedder is configured")
+	}
+	if opts.Sort != "" && opts.Sort != "score" {
+		return nil, fmt.Errorf("sorting by %s is only supported in %s mode", opts.Sort, SearchModeKeyword)
+	}
+	parsed, err := parseQuery(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(parsed.text) == "" {
+		return nil, fmt.Errorf("query text is required in %s mode", SearchModeSemantic)
+	}
+
+	set, err := s.loadVectors(index)
+	if err != nil {
+		return nil, err
+	}
+	switch set.embedder {
+	case s.embedder.Name():
+	case "":
+		return nil, fmt.Errorf("index has no embeddings, rebuild it with an embedder enabled")
+	default:
+		return nil, fmt.Errorf("index was built with embedder %s, rebuild it to search with %s",
+			set.embedder, s.embedder.Name())
+	}
+
+	var allowed map[string]bool
+	if opts.hasFilters() || parsed.hasFields() {
+		allowed, err = filteredIDs(ctx, index, parsed, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	vectors, err := s.embedder.Embed(ctx, []string{parsed.text})
+	if err != nil {
+		return nil, fmt.Errorf("embedding query: %w", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("expected 1 query vector, got %d", len(vectors))
+	}
+	ranked := set.rank(vectors[0], allowed)
+	set.projectFirst(ranked)
+	return ranked, nil
+}
+
+// loadVectors returns vectors of index, they are kept in memory until index changes.
+func (s *searcher) loadVectors(index bleve.Index) (*vectorSet, error) {
+	s.vectorsMu.Lock()
+	defer s.vectorsMu.Unlock()
+
+	if s.vectors != nil && s.vectors.index == index {
+		return s.vectors, nil
+	}
+	set, err := loadVectors(index)
+	if err != nil {
+		return nil, fmt.Errorf("loading vectors: %w", err)
+	}
+	s.vectors = set
+	return set, nil
+}
+
+func (s *searcher) resetVectors() {
+	s.vectorsMu.Lock()
+	s.vectors = nil
+	s.vectorsMu.Unlock()
+}
+
+// filteredIDs returns ids of all documents matching field clauses of query and filters of opts.
+func filteredIDs(
+	ctx context.Context,
+	index bleve.Index,
+	parsed *parsedQuery,
+	opts SearchOptions,
+) (map[string]bool, error) {
+	filterQuery, err := opts.withFilters(parsed.filter(bleve.NewMatchAllQuery()))
+	if err != nil {
+		return nil, err
+	}
+	count, err := index.DocCount()
+	if err != nil {
+		return nil, fmt.Errorf("counting documents: %w", err)
+	}
+
+	request := bleve.NewSearchRequestOptions(filterQuery, int(count), 0, false)
+	result, err := index.SearchInContext(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("search error: %w", err)
+	}
+
+	ids := make(map[string]bool, len(result.Hits))
+	for _, hit := range result.Hits {
+		ids[hit.ID] = true
+	}
+	return ids, nil
+}
+
+// fetchResults loads documents by id as search results, preview is the beginning of content.
+func fetchResults(ctx context.Context, index bleve.Index, ids []string) (map[string]SearchResult, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	request := bleve.NewSearchRequestOptions(bleve.NewDocIDQuery(ids), len(ids), 0, false)
+	request.Fields = resultFields
+	result, err := index.SearchInContext(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("search error: %w", err)
+	}
+
+	results := make(map[string]SearchResult, len(result.Hits))
+	for _, hit := range result.Hits {
+		sr := hitResult(hit)
+		if content, ok := hit.Fields["content"].(string); ok {
+			sr.Preview = contentPreview(content)
+		}
+		results[hit.ID] = sr
+	}
+	return results, nil
+}
+
+const previewLength = 200
+
+// contentPreview returns the beginning of content, as there is no match to highlight.
+func contentPreview(content string) string {
+	content = strings.TrimSpace(content)
+	if len(content) > previewLength {
+		content = content[:previewLength] + "..."
+	}
+	return content
+}
+
+func pageOf(docs []scoredID, offset, limit int) []scoredID {
+	if offset >= len(docs) {
+		return nil
+	}
+	return docs[offset:min(offset+limit, len(docs))]
+}
+
+func sortScored(docs []scoredID) {
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].score != docs[j].score {
+			return docs[i].score > docs[j].score
+		}
+		return docs[i].id < docs[j].id
+	})
+}
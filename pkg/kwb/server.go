@@ -3,6 +3,8 @@ package kwb
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -23,32 +25,117 @@ func NewMCPServer(service *Service) *MCPServer {
 	}
 }
 
-func (s *MCPServer) Serve(_ context.Context) error {
+// Serve serves MCP clients over configured transport until ctx is cancelled.
+func (s *MCPServer) Serve(ctx context.Context) error {
+	subscriptions := newResourceSubscriptions()
 	mcpServer := server.NewMCPServer(
 		serverName,
 		serverVersion,
+		server.WithResourceCapabilities(true, true),
+		server.WithHooks(subscriptions.hooks()),
+		server.WithPaginationLimit(resourcePageSize),
 	)
 
 	searchTool := mcp.NewTool("search",
 		mcp.WithDescription("Search the knowledge base"),
-		mcp.WithString("query", mcp.Required(), mcp.Description("Search query")),
+		mcp.WithString("query", mcp.Required(),
+			mcp.Description("Search query, may be scoped with prefixes type:, path: (glob), ext:, sym:, pkg:, repo:, "+
+				"prefix with - to exclude, e.g. 'retry type:code -path:vendor/** sym:New*'"),
+		),
 		mcp.WithNumber("limit", mcp.Description("Maximum results (default: 10)")),
+		mcp.WithArray("repos",
+			mcp.Description("Filter by repos, if index has several roots"),
+			mcp.WithStringItems()),
+		mcp.WithArray("types",
+			mcp.Description("Filter by document types: code, documentation, config, ..."),
+			mcp.WithStringItems()),
+		mcp.WithArray("paths",
+			mcp.Description("Include only paths matching globs or directory prefixes, e.g. pkg/kwb, **/*_test.go"),
+			mcp.WithStringItems()),
+		mcp.WithArray("exclude_paths",
+			mcp.Description("Exclude paths matching globs or directory prefixes"),
+			mcp.WithStringItems()),
+		mcp.WithArray("extensions",
+			mcp.Description("Filter by file extensions, e.g. .go, .md"),
+			mcp.WithStringItems()),
+		mcp.WithNumber("offset", mcp.Description("Number of results to skip (default: 0)")),
+		mcp.WithString("sort",
+			mcp.Description("Sort order: score (default), path, type; prefix with - for descending"),
+		),
+		mcp.WithString("mode",
+			mcp.Description("Search mode: keyword (default), semantic for natural language questions, "+
+				"or hybrid combining both"),
+			mcp.Enum(SearchModeKeyword, SearchModeSemantic, SearchModeHybrid),
+		),
+		mcp.WithBoolean("group", mcp.Description("Group results per file")),
+		mcp.WithBoolean("facets",
+			mcp.Description("Include counts of matching files per type and directory (default: true)")),
 	)
 	mcpServer.AddTool(searchTool, s.searchHandler)
 
 	getFileTool := mcp.NewTool("get_file",
 		mcp.WithDescription("Get full content of a specific file"),
 		mcp.WithString("path", mcp.Required(), mcp.Description("File path")),
+		mcp.WithString("repo", mcp.Description("Repo of the file, if index has several roots")),
 	)
 	mcpServer.AddTool(getFileTool, s.getFileHandler)
 
+	getFileRangeTool := mcp.NewTool("get_file_range",
+		mcp.WithDescription("Get numbered lines of a file, use instead of get_file for large files"),
+		mcp.WithString("path", mcp.Required(), mcp.Description("File path")),
+		mcp.WithString("repo", mcp.Description("Repo of the file, if index has several roots")),
+		mcp.WithNumber("start", mcp.Required(), mcp.Description("First line, 1-based")),
+		mcp.WithNumber("end", mcp.Description("Last line, inclusive (default: end of file)")),
+	)
+	mcpServer.AddTool(getFileRangeTool, s.getFileRangeHandler)
+
+	outlineTool := mcp.NewTool("outline",
+		mcp.WithDescription("List declarations of a Go, protobuf or SQL file with their line ranges"),
+		mcp.WithString("path", mcp.Required(), mcp.Description("File path")),
+		mcp.WithString("repo", mcp.Description("Repo of the file, if index has several roots")),
+	)
+	mcpServer.AddTool(outlineTool, s.outlineHandler)
+
+	searchHistoryTool := mcp.NewTool("search_history",
+		mcp.WithDescription("Search messages and diffs of recent commits, answers when and why code changed. "+
+			"Available if index was built with history"),
+		mcp.WithString("query", mcp.Description("Search query, newest commits are listed if empty")),
+		mcp.WithString("path", mcp.Description("Only commits touching paths matching glob or directory prefix")),
+		mcp.WithString("author", mcp.Description("Only commits by author, name or email")),
+		mcp.WithString("repo", mcp.Description("Filter by repo, if index has several roots")),
+		mcp.WithNumber("limit", mcp.Description("Maximum commits (default: 10)")),
+	)
+	mcpServer.AddTool(searchHistoryTool, s.searchHistoryHandler)
+
+	getSectionTool := mcp.NewTool("get_section",
+		mcp.WithDescription("Get a section of a markdown file with its subsections"),
+		mcp.WithString("path", mcp.Required(), mcp.Description("File path")),
+		mcp.WithString("section", mcp.Required(),
+			mcp.Description("Anchor (e.g. debugging), heading path (e.g. 'Workflows > Debugging') or heading")),
+		mcp.WithString("repo", mcp.Description("Repo of the file, if index has several roots")),
+	)
+	mcpServer.AddTool(getSectionTool, s.getSectionHandler)
+
 	listFilesTool := mcp.NewTool("list_files",
 		mcp.WithDescription("List all indexed files"),
 		mcp.WithString("type", mcp.Description("Filter by type: code, documentation, config")),
+		mcp.WithString("repo", mcp.Description("Filter by repo, if index has several roots")),
+		mcp.WithNumber("limit", mcp.Description("Maximum files per page (default: 200)")),
+		mcp.WithNumber("offset", mcp.Description("Number of files to skip (default: 0)")),
+		mcp.WithString("cursor", mcp.Description("Cursor returned by previous page, takes precedence over offset")),
 	)
 	mcpServer.AddTool(listFilesTool, s.listFilesHandler)
 
-	return server.ServeStdio(mcpServer)
+	if err := s.addResources(ctx, mcpServer, subscriptions); err != nil {
+		return fmt.Errorf("adding resources: %w", err)
+	}
+
+	switch transport := s.service.settings.Transport; transport {
+	case TransportHTTP, TransportSSE:
+		return s.serveHTTP(ctx, mcpServer, transport)
+	default:
+		return s.serveStdio(ctx, mcpServer)
+	}
 }
 
 func (s *MCPServer) searchHandler(
@@ -56,32 +143,103 @@ func (s *MCPServer) searchHandler(
 	request mcp.CallToolRequest,
 ) (*mcp.CallToolResult, error) {
 	query := request.GetString("query", "")
-	limit := request.GetInt("limit", 10)
+	opts := SearchOptions{
+		Repos:        request.GetStringSlice("repos", nil),
+		Types:        request.GetStringSlice("types", nil),
+		Paths:        request.GetStringSlice("paths", nil),
+		ExcludePaths: request.GetStringSlice("exclude_paths", nil),
+		Extensions:   request.GetStringSlice("extensions", nil),
+		Offset:       request.GetInt("offset", 0),
+		Limit:        request.GetInt("limit", 10),
+		Sort:         request.GetString("sort", ""),
+		Facets:       request.GetBool("facets", true),
+		Mode:         request.GetString("mode", ""),
+	}
 
-	results, err := s.service.Search(ctx, query, limit)
+	response, err := s.service.Search(ctx, query, opts)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Search error: %v", err)), nil
 	}
 
-	output := fmt.Sprintf("Found %d results:\n\n", len(results))
-	for i, result := range results {
-		output += fmt.Sprintf("%d. %s (score: %.2f, type: %s)\n",
-			i+1, result.Path, result.Score, result.Type)
+	results := response.Results
+	footer := ""
+	if response.HasMore() {
+		footer = fmt.Sprintf("More results available, request next page with offset: %d\n", response.NextOffset())
+	}
+	footer += formatFacets(response.Facets)
 
-		if result.Preview != "" {
-			output += fmt.Sprintf("   Preview: %s\n", result.Preview)
+	if request.GetBool("group", false) {
+		groups := GroupByFile(results)
+		output := fmt.Sprintf("Found %d results (showing %d in %d files):\n\n",
+			response.Total, len(results), len(groups))
+		for i, group := range groups {
+			output += fmt.Sprintf("%d. %s (score: %.2f, type: %s)\n",
+				i+1, group.Location(), group.Score, group.Type)
+			for _, result := range group.Results {
+				output += formatSearchResult("   - ", result)
+			}
+			output += "\n"
 		}
+		output += footer
+		return mcp.NewToolResultText(output), nil
+	}
+
+	output := fmt.Sprintf("Found %d results", response.Total)
+	if len(results) > 0 {
+		output += fmt.Sprintf(" (showing %d-%d)", response.Offset+1, response.NextOffset())
+	}
+	output += ":\n\n"
+	for i, result := range results {
+		output += formatSearchResult(fmt.Sprintf("%d. ", response.Offset+i+1), result)
 		output += "\n"
 	}
+	output += footer
 
 	return mcp.NewToolResultText(output), nil
 }
 
+func formatSearchResult(prefix string, result SearchResult) string {
+	indent := strings.Repeat(" ", len(prefix))
+	output := fmt.Sprintf("%s%s (score: %.2f, type: %s)\n",
+		prefix, result.Location(), result.Score, result.Type)
+
+	if result.Signature != "" {
+		output += fmt.Sprintf("%s%s: %s\n", indent, result.SymbolKind, result.Signature)
+	}
+	if result.Section != "" {
+		output += fmt.Sprintf("%sSection: %s (anchor: %s)\n", indent, result.Section, result.Anchor)
+	}
+	if result.StartLine > 0 {
+		output += fmt.Sprintf("%sLines: %d-%d\n", indent, result.StartLine, result.EndLine)
+	}
+	if result.Preview != "" {
+		output += fmt.Sprintf("%sPreview: %s\n", indent, result.Preview)
+	}
+	return output
+}
+
+func formatFacets(facets []Facet) string {
+	output := ""
+	for _, facet := range facets {
+		if len(facet.Terms) == 0 {
+			continue
+		}
+		output += fmt.Sprintf("\nMatching files by %s:\n", facet.Field)
+		for _, term := range facet.Terms {
+			output += fmt.Sprintf("- %s: %d\n", term.Term, term.Count)
+		}
+		if facet.Other > 0 {
+			output += fmt.Sprintf("- (other): %d\n", facet.Other)
+		}
+	}
+	return output
+}
+
 func (s *MCPServer) getFileHandler(
 	ctx context.Context,
 	request mcp.CallToolRequest,
 ) (*mcp.CallToolResult, error) {
-	path := request.GetString("path", "")
+	path := requestedFile(request)
 	content, err := s.service.GetFile(ctx, path)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Error reading file: %v", err)), nil
@@ -89,21 +247,160 @@ func (s *MCPServer) getFileHandler(
 	return mcp.NewToolResultText(content), nil
 }
 
+func (s *MCPServer) getFileRangeHandler(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	path := requestedFile(request)
+	start := request.GetInt("start", 1)
+	end := request.GetInt("end", 0)
+
+	r, err := s.service.GetFileRange(ctx, path, start, end)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error reading file: %v", err)), nil
+	}
+
+	output := fmt.Sprintf("%s (lines %d-%d of %d)\n\n", r.Path, r.StartLine, r.EndLine, r.TotalLines)
+	width := len(strconv.Itoa(r.EndLine))
+	for i, line := range r.Lines {
+		output += fmt.Sprintf("%*d\t%s\n", width, r.StartLine+i, line)
+	}
+
+	return mcp.NewToolResultText(output), nil
+}
+
+func (s *MCPServer) outlineHandler(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	path := requestedFile(request)
+
+	symbols, err := s.service.Outline(ctx, path)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error getting outline: %v", err)), nil
+	}
+
+	output := fmt.Sprintf("%s: %d declarations\n\n", path, len(symbols))
+	var parents []Symbol
+	for _, symbol := range symbols {
+		// Nested declarations such as fields and columns are indented under their parents
+		for len(parents) > 0 && !nestedIn(symbol, parents[len(parents)-1]) {
+			parents = parents[:len(parents)-1]
+		}
+		indent := strings.Repeat("  ", len(parents))
+		parents = append(parents, symbol)
+
+		// Signature starts with declaration keyword, which tells the kind
+		output += fmt.Sprintf("%d-%d\t%s%s\n", symbol.StartLine, symbol.EndLine, indent, firstLine(symbol.Signature))
+	}
+
+	return mcp.NewToolResultText(output), nil
+}
+
+// nestedIn reports whether symbol is declared within parent, methods are not nested in their types.
+func nestedIn(symbol, parent Symbol) bool {
+	return symbol.Receiver != "" && symbol.Kind != symbolMethod &&
+		parent.StartLine <= symbol.StartLine && symbol.EndLine <= parent.EndLine
+}
+
+// historyFilesShown is the number of touched files listed per commit.
+const historyFilesShown = 10
+
+func (s *MCPServer) searchHistoryHandler(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	query := request.GetString("query", "")
+	opts := HistoryOptions{
+		Repo:   request.GetString("repo", ""),
+		Path:   request.GetString("path", ""),
+		Author: request.GetString("author", ""),
+		Limit:  request.GetInt("limit", 10),
+	}
+
+	response, err := s.service.SearchHistory(ctx, query, opts)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Search error: %v", err)), nil
+	}
+
+	output := fmt.Sprintf("Found %d commits", response.Total)
+	if len(response.Commits) > 0 {
+		output += fmt.Sprintf(" (showing %d)", len(response.Commits))
+	}
+	output += ":\n\n"
+	for _, c := range response.Commits {
+		output += fmt.Sprintf("%s %s %s\n", fileID(c.Repo, c.Commit), c.Date.Format("2006-01-02"), c.Summary)
+		output += fmt.Sprintf("   Author: %s\n", c.Author)
+		if files := c.Files; len(files) > 0 {
+			more := ""
+			if len(files) > historyFilesShown {
+				more = fmt.Sprintf(" and %d more", len(files)-historyFilesShown)
+				files = files[:historyFilesShown]
+			}
+			output += fmt.Sprintf("   Files: %s%s\n", strings.Join(files, ", "), more)
+		}
+	}
+
+	return mcp.NewToolResultText(output), nil
+}
+
+func (s *MCPServer) getSectionHandler(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	path := requestedFile(request)
+
+	section, err := s.service.GetSection(ctx, path, request.GetString("section", ""))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error getting section: %v", err)), nil
+	}
+
+	output := fmt.Sprintf("%s#%s: %s (lines %d-%d)\n\n%s",
+		section.Path, section.Anchor, section.Heading, section.StartLine, section.EndLine, section.Content)
+	return mcp.NewToolResultText(output), nil
+}
+
+// requestedFile returns id of a file given by path and optional repo arguments.
+func requestedFile(request mcp.CallToolRequest) string {
+	return fileID(request.GetString("repo", ""), request.GetString("path", ""))
+}
+
+// firstLine returns s up to the first line break.
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
 func (s *MCPServer) listFilesHandler(
 	ctx context.Context,
 	request mcp.CallToolRequest,
 ) (*mcp.CallToolResult, error) {
-	fileType := request.GetString("type", "")
+	opts := ListOptions{
+		Type:   request.GetString("type", ""),
+		Repo:   request.GetString("repo", ""),
+		Offset: request.GetInt("offset", 0),
+		Cursor: request.GetString("cursor", ""),
+		Limit:  request.GetInt("limit", 200),
+	}
 
-	files, err := s.service.ListFiles(ctx, fileType)
+	list, err := s.service.ListFiles(ctx, opts)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Error listing files: %v", err)), nil
 	}
 
-	output := fmt.Sprintf("Total files: %d\n\n", len(files))
-	for _, file := range files {
+	output := fmt.Sprintf("Total files: %d\n", list.Total)
+	if list.Offset >= 0 {
+		output += fmt.Sprintf("Showing: %d-%d\n", list.Offset+1, list.Offset+len(list.Files))
+	}
+	output += "\n"
+	for _, file := range list.Files {
 		output += fmt.Sprintf("- %s\n", file)
 	}
+	if list.NextCursor != "" {
+		output += fmt.Sprintf("\nMore files available, request next page with cursor: %q\n", list.NextCursor)
+	}
 
 	return mcp.NewToolResultText(output), nil
 }
@@ -8,9 +8,12 @@ import (
 
 type Service struct {
 	logger       *slog.Logger
+	version      string
+	embedder     Embedder
 	settings     *Settings
 	indexManager *indexManager
 	searcher     *searcher
+	watcher      *watcher
 }
 
 func NewService(settings *Settings, opts ...Option) (*Service, error) {
@@ -29,22 +32,33 @@ func NewService(settings *Settings, opts ...Option) (*Service, error) {
 	if svc.logger == nil {
 		svc.logger = slog.New(slog.DiscardHandler)
 	}
+	if svc.embedder == nil {
+		svc.embedder = newEmbedder(settings)
+	}
 
 	svc.indexManager = newIndexManager(
 		settings,
+		svc.version,
+		svc.embedder,
 		svc.logger.With("component", "index_manager"),
 	)
-	svc.searcher = newSearcher(settings, svc.indexManager)
+	svc.searcher = newSearcher(settings, svc.indexManager, svc.embedder)
+	svc.watcher = newWatcher(
+		settings,
+		svc.indexManager,
+		svc.logger.With("component", "watcher"),
+	)
 
 	return svc, nil
 }
 
-func (s *Service) BuildIndex(ctx context.Context, rootPath string) error {
+// BuildIndex indexes files of roots, files of roots which are no longer given are dropped.
+func (s *Service) BuildIndex(ctx context.Context, roots []Root) error {
 	s.logger.InfoContext(ctx, "Building knowledge base index",
-		slog.String("root", rootPath),
+		slog.Any("roots", roots),
 		slog.String("index_path", s.settings.IndexPath))
 
-	if err := s.indexManager.BuildIndex(rootPath); err != nil {
+	if err := s.indexManager.BuildIndex(roots); err != nil {
 		return fmt.Errorf("building index: %w", err)
 	}
 
@@ -61,20 +75,65 @@ func (s *Service) BuildIndex(ctx context.Context, rootPath string) error {
 	return nil
 }
 
-func (s *Service) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+// Watch updates index on file changes under roots until ctx is cancelled.
+// Index is brought up to date with the file trees before watching starts.
+// Nil roots watch the roots index was built from, with the same indexing options.
+func (s *Service) Watch(ctx context.Context, roots []Root) error {
+	s.logger.InfoContext(ctx, "Synchronizing knowledge base index",
+		slog.Any("roots", roots),
+		slog.String("index_path", s.settings.IndexPath))
+
+	roots, err := s.indexManager.SyncIndex(roots)
+	if err != nil {
+		return fmt.Errorf("synchronizing index: %w", err)
+	}
+
+	if err := s.watcher.Run(ctx, roots); err != nil {
+		return fmt.Errorf("watching: %w", err)
+	}
+
+	return nil
+}
+
+// OnIndexChange registers fn to be called whenever files are re-indexed,
+// by watcher or by a build which published new index generation.
+func (s *Service) OnIndexChange(fn func(IndexChange)) {
+	s.indexManager.onChange(fn)
+}
+
+func (s *Service) Search(ctx context.Context, query string, opts SearchOptions) (*SearchResponse, error) {
 	s.logger.InfoContext(ctx, "Searching knowledge base",
 		slog.String("query", query),
-		slog.Int("limit", limit))
+		slog.Any("options", opts))
 
-	results, err := s.searcher.Search(query, limit)
+	response, err := s.searcher.Search(ctx, query, opts)
 	if err != nil {
 		return nil, fmt.Errorf("searching: %w", err)
 	}
 
 	s.logger.InfoContext(ctx, "Search complete",
-		slog.Int("results", len(results)))
+		slog.Int("results", len(response.Results)),
+		slog.Uint64("total", response.Total))
+
+	return response, nil
+}
+
+// SearchHistory searches commits indexed with history enabled.
+func (s *Service) SearchHistory(ctx context.Context, query string, opts HistoryOptions) (*HistoryResponse, error) {
+	s.logger.InfoContext(ctx, "Searching history",
+		slog.String("query", query),
+		slog.Any("options", opts))
+
+	response, err := s.searcher.SearchHistory(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("searching history: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "History search complete",
+		slog.Int("results", len(response.Commits)),
+		slog.Uint64("total", response.Total))
 
-	return results, nil
+	return response, nil
 }
 
 func (s *Service) GetFile(ctx context.Context, path string) (string, error) {
@@ -89,19 +148,64 @@ func (s *Service) GetFile(ctx context.Context, path string) (string, error) {
 	return content, nil
 }
 
-func (s *Service) ListFiles(ctx context.Context, fileType string) ([]string, error) {
+// GetFileRange returns lines start through end of a file, both 1-based and inclusive.
+// End of 0 selects everything up to the end of file.
+func (s *Service) GetFileRange(ctx context.Context, path string, start, end int) (*FileRange, error) {
+	s.logger.InfoContext(ctx, "Getting file range",
+		slog.String("path", path),
+		slog.Int("start", start),
+		slog.Int("end", end))
+
+	r, err := s.searcher.GetFileRange(path, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("getting file range: %w", err)
+	}
+
+	return r, nil
+}
+
+// Outline returns declarations of a Go, protobuf or SQL file with their line ranges.
+func (s *Service) Outline(ctx context.Context, path string) ([]Symbol, error) {
+	s.logger.InfoContext(ctx, "Getting file outline",
+		slog.String("path", path))
+
+	symbols, err := s.searcher.Outline(path)
+	if err != nil {
+		return nil, fmt.Errorf("getting outline: %w", err)
+	}
+
+	return symbols, nil
+}
+
+// GetSection returns section of a markdown file with its subsections,
+// given by anchor or heading path.
+func (s *Service) GetSection(ctx context.Context, path, section string) (*Section, error) {
+	s.logger.InfoContext(ctx, "Getting file section",
+		slog.String("path", path),
+		slog.String("section", section))
+
+	found, err := s.searcher.GetSection(path, section)
+	if err != nil {
+		return nil, fmt.Errorf("getting section: %w", err)
+	}
+
+	return found, nil
+}
+
+func (s *Service) ListFiles(ctx context.Context, opts ListOptions) (*FileList, error) {
 	s.logger.InfoContext(ctx, "Listing files",
-		slog.String("type", fileType))
+		slog.Any("options", opts))
 
-	files, err := s.searcher.ListFiles(fileType)
+	list, err := s.searcher.ListFiles(ctx, opts)
 	if err != nil {
 		return nil, fmt.Errorf("listing files: %w", err)
 	}
 
 	s.logger.InfoContext(ctx, "List complete",
-		slog.Int("count", len(files)))
+		slog.Int("count", len(list.Files)),
+		slog.Uint64("total", list.Total))
 
-	return files, nil
+	return list, nil
 }
 
 func (s *Service) GetStats(ctx context.Context) (map[string]interface{}, error) {
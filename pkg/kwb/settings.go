@@ -7,20 +7,45 @@ import (
 )
 
 type Settings struct {
-	RootPath  string // Directory to index
-	IndexPath string // Path to store the index
+	Roots     []string // Directories to index, as "path" or "alias=path"
+	IndexPath string   // Path to store the index
 
 	// Indexing options
 	ExtraExtensions []string
-	ExcludeDirs     []string
+	ExcludeDirs     []string // Directory names or gitignore-style patterns relative to root, files never match
+	NoGitignore     bool     // Do not honour .gitignore and .git/info/exclude files
+	DenyFiles       []string // File name patterns which are never indexed, in addition to defaults
 	MaxFileSize     int
 	BatchSize       int    // Number of documents to index in a batch
 	IndexType       string // Index type: "scorch" (default) or "upsidedown"
+	FullRebuild     bool   // Discard existing index instead of updating it incrementally
+	ChunkLines      int    // Files longer than this are split into chunks (0 = disabled)
+	ChunkOverlap    int    // Number of lines shared by consecutive chunks
+	Analyzer        string // Text analyzer: "code" (default) or "standard"
+	IndexDeps       bool   // Index sources of modules required by go.mod, found in module cache
+	HistoryCommits  int    // Number of last commits of each root to index, 0 to disable
+
+	// Embedding options
+	Embedder        string // Embedder for semantic search: "hash" (default), "openai" or "none"
+	EmbeddingURL    string // Base URL of OpenAI-compatible API, e.g. http://localhost:11434/v1
+	EmbeddingModel  string // Embedding model served by the API
+	EmbeddingAPIKey string // API key, if the API requires one
+
+	// Watch options
+	WatchDebounce time.Duration // Quiet period before collected changes are indexed
+
+	// Server options
+	Transport  string // MCP transport: "stdio" (default), "http" or "sse"
+	ListenAddr string // Address to listen on for http and sse transports
+	AuthToken  string // Bearer token required from http and sse clients (empty = no auth)
+	// Serve any file under indexed root, not only indexed ones
+	AllowUnindexedReads bool
 
 	// Search options
 	SearchTimeout   time.Duration
 	SearchLimit     int
 	SearchShowScore bool
+	SearchGroup     bool   // Group results per file
 	SearchFuzziness int    // Fuzzy search distance (0 = exact match, 1-2 = fuzzy)
 	HighlightStyle  string // Highlight style: "html" or "ansi"
 }
@@ -51,6 +76,36 @@ func (s *Settings) Validate() error {
 	if s.SearchFuzziness < 0 || s.SearchFuzziness > 2 {
 		return fmt.Errorf("search fuzziness must be between 0 and 2")
 	}
+	if s.ChunkLines < 0 {
+		return fmt.Errorf("chunk lines cannot be negative")
+	}
+	if s.ChunkLines > 0 && (s.ChunkOverlap < 0 || s.ChunkOverlap >= s.ChunkLines) {
+		return fmt.Errorf("chunk overlap must be between 0 and chunk lines")
+	}
+	if s.Analyzer != "" && s.Analyzer != AnalyzerCode && s.Analyzer != AnalyzerStandard {
+		return fmt.Errorf("invalid analyzer: %s (must be '%s' or '%s')", s.Analyzer, AnalyzerCode, AnalyzerStandard)
+	}
+	if s.Transport != "" && s.Transport != TransportStdio &&
+		s.Transport != TransportHTTP && s.Transport != TransportSSE {
+		return fmt.Errorf("invalid transport: %s (must be '%s', '%s' or '%s')",
+			s.Transport, TransportStdio, TransportHTTP, TransportSSE)
+	}
+	if (s.Transport == TransportHTTP || s.Transport == TransportSSE) &&
+		s.ListenAddr != "" && s.AuthToken == "" && !isLoopbackAddr(s.ListenAddr) {
+		return fmt.Errorf("auth token is required to listen on non-loopback address %s", s.ListenAddr)
+	}
+	if s.Embedder != "" && s.Embedder != EmbedderHash && s.Embedder != EmbedderOpenAI && s.Embedder != EmbedderNone {
+		return fmt.Errorf("invalid embedder: %s (must be '%s', '%s' or '%s')",
+			s.Embedder, EmbedderHash, EmbedderOpenAI, EmbedderNone)
+	}
+	if s.Embedder == EmbedderOpenAI && (s.EmbeddingURL == "" || s.EmbeddingModel == "") {
+		return fmt.Errorf("embedding url and model are required for '%s' embedder", EmbedderOpenAI)
+	}
+	if len(s.Roots) > 0 {
+		if _, err := ParseRoots(s.Roots); err != nil {
+			return err
+		}
+	}
 	if s.IndexType != "scorch" && s.IndexType != "upsidedown" {
 		return fmt.Errorf("invalid index type: %s (must be 'scorch' or 'upsidedown')", s.IndexType)
 	}
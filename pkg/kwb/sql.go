@@ -0,0 +1,359 @@
+package kwb
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	symbolTable  = "table"
+	symbolColumn = "column"
+)
+
+// sqlIdent matches plain, quoted and schema qualified identifiers.
+const (
+	sqlIdentPart = `(?:"[^"]+"|` + "`[^`]+`" + `|\[[^\]]+\]|[\w$]+)`
+	sqlIdent     = sqlIdentPart + `(?:\s*\.\s*` + sqlIdentPart + `)*`
+)
+
+var (
+	sqlCreateTableRe = regexp.MustCompile(`(?is)^create\s+(?:or\s+replace\s+)?(?:(?:global|local)\s+)?` +
+		`(?:(?:temp|temporary|unlogged)\s+)?table\s+(?:if\s+not\s+exists\s+)?(` + sqlIdent + `)\s*\(`)
+	sqlAlterTableRe = regexp.MustCompile(`(?is)^alter\s+table\s+(?:if\s+exists\s+)?(?:only\s+)?(` +
+		sqlIdent + `)\s+`)
+	sqlDropTableRe = regexp.MustCompile(`(?is)^drop\s+table\s+(?:if\s+exists\s+)?(` + sqlIdent + `)`)
+
+	sqlAddColumnRe    = regexp.MustCompile(`(?is)^add\s+(?:column\s+)?(?:if\s+not\s+exists\s+)?(` + sqlIdent + `)`)
+	sqlDropColumnRe   = regexp.MustCompile(`(?is)^drop\s+(?:column\s+)?(?:if\s+exists\s+)?(` + sqlIdent + `)`)
+	sqlAlterColumnRe  = regexp.MustCompile(`(?is)^(?:alter|modify|change)\s+(?:column\s+)?(` + sqlIdent + `)`)
+	sqlRenameColumnRe = regexp.MustCompile(`(?is)^rename\s+(?:column\s+)?(` + sqlIdent + `)\s+to\s+(` +
+		sqlIdent + `)`)
+	sqlLeadingIdentRe = regexp.MustCompile(`^` + sqlIdent)
+	sqlLeadingWordRe  = regexp.MustCompile(`^\w+`)
+)
+
+// sqlConstraintWords start table constraints, which are not columns.
+var sqlConstraintWords = map[string]bool{
+	"constraint": true, "primary": true, "unique": true, "foreign": true, "check": true,
+	"key": true, "index": true, "exclude": true, "like": true, "fulltext": true, "spatial": true,
+	"period": true,
+}
+
+// parseSQLSymbols extracts tables and columns created, altered or dropped
+// by CREATE TABLE, ALTER TABLE and DROP TABLE statements as separate documents.
+// Columns are qualified by their tables, signature of a column altered by migration
+// is the statement, e.g. "ALTER TABLE users ADD COLUMN email text".
+func parseSQLSymbols(path string, content []byte) ([]document, error) {
+	src := string(content)
+	masked := maskSQLComments(src)
+	p := &sqlParser{
+		path:       path,
+		src:        src,
+		lineStarts: lineStarts(src),
+	}
+	for _, stmt := range splitSQLStatements(masked) {
+		p.parseStatement(masked, stmt)
+	}
+	return p.docs, nil
+}
+
+// sqlSpan is a part of SQL source given by byte offsets.
+type sqlSpan struct {
+	start, end int
+}
+
+type sqlParser struct {
+	path       string
+	src        string
+	lineStarts []int
+	docs       []document
+}
+
+func (p *sqlParser) parseStatement(masked string, stmt sqlSpan) {
+	text := masked[stmt.start:stmt.end]
+	if m := sqlCreateTableRe.FindStringSubmatchIndex(text); m != nil {
+		table := unquoteSQLIdent(text[m[2]:m[3]])
+		p.add(table, symbolTable, "", "CREATE TABLE "+table, stmt)
+
+		open := stmt.start + m[1] - 1
+		closing := matchingParen(masked, open, stmt.end)
+		for _, def := range splitSQLList(masked, open+1, closing) {
+			defText := masked[def.start:def.end]
+			word := strings.ToLower(sqlLeadingWordRe.FindString(defText))
+			if sqlConstraintWords[word] {
+				continue
+			}
+			ident := sqlLeadingIdentRe.FindString(defText)
+			if ident == "" {
+				continue
+			}
+			p.add(unquoteSQLIdent(ident), symbolColumn, table, collapseSpaces(defText), def)
+		}
+		return
+	}
+
+	if m := sqlAlterTableRe.FindStringSubmatchIndex(text); m != nil {
+		table := unquoteSQLIdent(text[m[2]:m[3]])
+		p.add(table, symbolTable, "", "ALTER TABLE "+table, stmt)
+
+		for _, action := range splitSQLList(masked, stmt.start+m[1], stmt.end) {
+			actionText := masked[action.start:action.end]
+			column := alteredColumn(actionText)
+			if column == "" {
+				continue
+			}
+			p.add(column, symbolColumn, table, "ALTER TABLE "+table+" "+collapseSpaces(actionText), action)
+		}
+		return
+	}
+
+	if m := sqlDropTableRe.FindStringSubmatch(text); m != nil {
+		table := unquoteSQLIdent(m[1])
+		p.add(table, symbolTable, "", "DROP TABLE "+table, stmt)
+	}
+}
+
+// alteredColumn returns column affected by ALTER TABLE action, empty if action is not about a column.
+func alteredColumn(action string) string {
+	if m := sqlRenameColumnRe.FindStringSubmatch(action); m != nil {
+		if strings.EqualFold(m[1], "to") {
+			return ""
+		}
+		return unquoteSQLIdent(m[2])
+	}
+	for _, re := range []*regexp.Regexp{sqlAddColumnRe, sqlDropColumnRe, sqlAlterColumnRe} {
+		m := re.FindStringSubmatch(action)
+		if m == nil {
+			continue
+		}
+		if sqlConstraintWords[strings.ToLower(m[1])] || strings.EqualFold(m[1], "column") {
+			return ""
+		}
+		return unquoteSQLIdent(m[1])
+	}
+	return ""
+}
+
+func (p *sqlParser) add(name, kind, table, signature string, span sqlSpan) {
+	start := p.line(span.start)
+	qualified := name
+	if table != "" {
+		qualified = table + "." + name
+	}
+	p.docs = append(p.docs, document{
+		ID:         fmt.Sprintf("%s#%s:%s:%d", p.path, kindSymbol, qualified, start),
+		Path:       p.path,
+		Content:    p.src[span.start:span.end],
+		Type:       getFileType(p.path),
+		Kind:       kindSymbol,
+		Receiver:   table,
+		Name:       name,
+		SymbolKind: kind,
+		Signature:  signature,
+		StartLine:  start,
+		EndLine:    p.line(max(span.end-1, span.start)),
+	})
+}
+
+// line returns 1-based line of byte offset.
+func (p *sqlParser) line(offset int) int {
+	return sort.Search(len(p.lineStarts), func(i int) bool { return p.lineStarts[i] > offset })
+}
+
+func lineStarts(src string) []int {
+	starts := []int{0}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// maskSQLComments replaces comments with spaces, keeping offsets and line breaks,
+// so statements can be matched without caring for comments.
+func maskSQLComments(src string) string {
+	b := []byte(src)
+	for i := 0; i < len(src); {
+		switch {
+		case src[i] == '\'' || src[i] == '"' || src[i] == '`':
+			i = skipSQLQuoted(src, i)
+		case src[i] == '$':
+			i = skipSQLDollarQuoted(src, i)
+		case strings.HasPrefix(src[i:], "--"):
+			for ; i < len(src) && src[i] != '\n'; i++ {
+				b[i] = ' '
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			stop := len(src)
+			if end := strings.Index(src[i+2:], "*/"); end >= 0 {
+				stop = i + 2 + end + 2
+			}
+			for ; i < stop; i++ {
+				if src[i] != '\n' {
+					b[i] = ' '
+				}
+			}
+		default:
+			i++
+		}
+	}
+	return string(b)
+}
+
+// splitSQLStatements splits comment-free source into statements separated by semicolons.
+func splitSQLStatements(masked string) []sqlSpan {
+	var spans []sqlSpan
+	start := 0
+	for i := 0; i < len(masked); {
+		switch masked[i] {
+		case '\'', '"', '`':
+			i = skipSQLQuoted(masked, i)
+			continue
+		case '$':
+			i = skipSQLDollarQuoted(masked, i)
+			continue
+		case ';':
+			if span, ok := trimSQLSpan(masked, start, i); ok {
+				spans = append(spans, span)
+			}
+			start = i + 1
+		}
+		i++
+	}
+	if span, ok := trimSQLSpan(masked, start, len(masked)); ok {
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// splitSQLList splits comma separated list between offsets,
+// commas within parentheses and quotes do not separate items.
+func splitSQLList(masked string, start, end int) []sqlSpan {
+	var spans []sqlSpan
+	depth := 0
+	itemStart := start
+	for i := start; i < end; {
+		switch masked[i] {
+		case '\'', '"', '`':
+			i = skipSQLQuoted(masked, i)
+			continue
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				if span, ok := trimSQLSpan(masked, itemStart, i); ok {
+					spans = append(spans, span)
+				}
+				itemStart = i + 1
+			}
+		}
+		i++
+	}
+	if span, ok := trimSQLSpan(masked, itemStart, end); ok {
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// trimSQLSpan trims whitespace around span, ok is false if nothing is left.
+func trimSQLSpan(masked string, start, end int) (sqlSpan, bool) {
+	for start < end && isSQLSpace(masked[start]) {
+		start++
+	}
+	for end > start && isSQLSpace(masked[end-1]) {
+		end--
+	}
+	return sqlSpan{start: start, end: end}, end > start
+}
+
+func isSQLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// matchingParen returns offset of parenthesis closing the one at open, or end if there is none.
+func matchingParen(masked string, open, end int) int {
+	depth := 0
+	for i := open; i < end; {
+		switch masked[i] {
+		case '\'', '"', '`':
+			i = skipSQLQuoted(masked, i)
+			continue
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+		i++
+	}
+	return end
+}
+
+// skipSQLQuoted returns offset after quoted literal or identifier starting at i,
+// doubled quote characters are escapes.
+func skipSQLQuoted(src string, i int) int {
+	quote := src[i]
+	for i++; i < len(src); i++ {
+		if src[i] != quote {
+			continue
+		}
+		if i+1 < len(src) && src[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(src)
+}
+
+// skipSQLDollarQuoted returns offset after PostgreSQL dollar quoted string starting at i,
+// e.g. function body in $$...$$, or i+1 if there is none.
+func skipSQLDollarQuoted(src string, i int) int {
+	end := i + 1
+	for end < len(src) && isSQLTagByte(src[end]) {
+		end++
+	}
+	if end >= len(src) || src[end] != '$' {
+		return i + 1
+	}
+	tag := src[i : end+1]
+	closing := strings.Index(src[end+1:], tag)
+	if closing < 0 {
+		return len(src)
+	}
+	return end + 1 + closing + len(tag)
+}
+
+// isSQLTagByte reports whether c may appear in tag of dollar quoted string.
+func isSQLTagByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// unquoteSQLIdent strips quotes of every part of identifier, e.g. "public"."users" becomes public.users.
+func unquoteSQLIdent(ident string) string {
+	parts := strings.Split(ident, ".")
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if len(part) >= 2 {
+			switch {
+			case part[0] == '"' && part[len(part)-1] == '"',
+				part[0] == '`' && part[len(part)-1] == '`',
+				part[0] == '[' && part[len(part)-1] == ']':
+				part = part[1 : len(part)-1]
+			}
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, ".")
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
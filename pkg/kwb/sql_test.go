@@ -0,0 +1,93 @@
+package kwb
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// symbolSummary lists symbols as "kind receiver.name:line", e.g. "column users.email:3".
+func symbolSummary(docs []document) []string {
+	var symbols []string
+	for _, doc := range docs {
+		name := doc.Name
+		if doc.Receiver != "" {
+			name = doc.Receiver + "." + name
+		}
+		symbols = append(symbols, fmt.Sprintf("%s %s:%d", doc.SymbolKind, name, doc.StartLine))
+	}
+	return symbols
+}
+
+func TestParseSQLSymbols(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "create table",
+			content: "CREATE TABLE IF NOT EXISTS users (\n" +
+				"  id bigint PRIMARY KEY,\n" +
+				"  email text NOT NULL,\n" +
+				"  CONSTRAINT users_email UNIQUE (email)\n" +
+				");\n",
+			want: []string{"table users:1", "column users.id:2", "column users.email:3"},
+		},
+		{
+			name: "quoted identifiers",
+			content: "CREATE TABLE \"public\".\"Order Items\" (\n" +
+				"  \"Item Id\" int,\n" +
+				"  `qty` int,\n" +
+				"  [price] numeric(10, 2)\n" +
+				");\n",
+			want: []string{
+				"table public.Order Items:1",
+				"column public.Order Items.Item Id:2",
+				"column public.Order Items.qty:3",
+				"column public.Order Items.price:4",
+			},
+		},
+		{
+			name: "alter and rename column",
+			content: "ALTER TABLE users ADD COLUMN age int, DROP COLUMN legacy;\n" +
+				"ALTER TABLE users RENAME COLUMN email TO contact;\n" +
+				"ALTER TABLE users ALTER COLUMN age SET NOT NULL;\n" +
+				"ALTER TABLE users RENAME TO accounts;\n",
+			want: []string{
+				"table users:1", "column users.age:1", "column users.legacy:1",
+				"table users:2", "column users.contact:2",
+				"table users:3", "column users.age:3",
+				"table users:4",
+			},
+		},
+		{
+			name: "dollar quoted body",
+			content: "CREATE FUNCTION touch() RETURNS trigger AS $body$\n" +
+				"BEGIN\n" +
+				"  CREATE TABLE fake (id int);\n" +
+				"END;\n" +
+				"$body$ LANGUAGE plpgsql;\n" +
+				"DROP TABLE old_users;\n",
+			want: []string{"table old_users:6"},
+		},
+		{
+			name: "comments",
+			content: "-- CREATE TABLE commented (id int);\n" +
+				"/* DROP TABLE users; */\n" +
+				"CREATE TABLE t (id int); -- trailing\n",
+			want: []string{"table t:3", "column t.id:3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := parseSQLSymbols("migrations/001.sql", []byte(tt.content))
+			if err != nil {
+				t.Fatalf("parseSQLSymbols() error = %v", err)
+			}
+			if got := symbolSummary(docs); !slices.Equal(got, tt.want) {
+				t.Errorf("parseSQLSymbols() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
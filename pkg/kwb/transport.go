@@ -0,0 +1,141 @@
+package kwb
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Transports which can be used to serve MCP clients.
+const (
+	TransportStdio = "stdio"
+	TransportHTTP  = "http"
+	TransportSSE   = "sse"
+)
+
+const (
+	httpEndpointPath    = "/mcp"
+	shutdownTimeout     = 10 * time.Second
+	readHeaderTimeout   = 10 * time.Second
+	defaultListenAddr   = "127.0.0.1:8080"
+	authorizationHeader = "Authorization"
+	bearerPrefix        = "Bearer "
+)
+
+// serveStdio serves single client over stdin and stdout until ctx is cancelled or input is closed.
+func (s *MCPServer) serveStdio(ctx context.Context, mcpServer *server.MCPServer) error {
+	stdio := server.NewStdioServer(mcpServer)
+	stdio.SetErrorLogger(slog.NewLogLogger(s.service.logger.Handler(), slog.LevelError))
+
+	err := stdio.Listen(ctx, os.Stdin, os.Stdout)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return fmt.Errorf("serving stdio: %w", err)
+	}
+	return nil
+}
+
+// serveHTTP serves any number of clients over streamable HTTP or SSE until ctx is cancelled.
+// Active connections are given shutdownTimeout to complete.
+func (s *MCPServer) serveHTTP(ctx context.Context, mcpServer *server.MCPServer, transport string) error {
+	addr := s.service.settings.ListenAddr
+	if addr == "" {
+		addr = defaultListenAddr
+	}
+
+	httpServer := &http.Server{
+		Addr:              addr,
+		ReadHeaderTimeout: readHeaderTimeout,
+		// Long-lived streams are closed as soon as ctx is cancelled,
+		// otherwise they would hold shutdown until timeout.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	var shutdown func(context.Context) error
+	switch transport {
+	case TransportSSE:
+		sse := server.NewSSEServer(mcpServer, server.WithHTTPServer(httpServer))
+		httpServer.Handler = sse
+		shutdown = sse.Shutdown
+	default:
+		streamable := server.NewStreamableHTTPServer(mcpServer,
+			server.WithStreamableHTTPServer(httpServer),
+			server.WithEndpointPath(httpEndpointPath))
+		mux := http.NewServeMux()
+		mux.Handle(httpEndpointPath, streamable)
+		httpServer.Handler = mux
+		shutdown = streamable.Shutdown
+	}
+	if token := s.service.settings.AuthToken; token != "" {
+		httpServer.Handler = requireBearerToken(token, httpServer.Handler)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", addr, err)
+	}
+
+	s.service.logger.InfoContext(ctx, "Serving MCP",
+		slog.String("transport", transport),
+		slog.String("address", listener.Addr().String()),
+		slog.Bool("auth", s.service.settings.AuthToken != ""))
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("serving %s: %w", transport, err)
+	case <-ctx.Done():
+	}
+
+	s.service.logger.Info("Shutting down MCP server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down: %w", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving %s: %w", transport, err)
+	}
+	return nil
+}
+
+// isLoopbackAddr reports whether listen address accepts connections from local host only.
+// Address without host listens on all interfaces.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requireBearerToken rejects requests which do not carry the token in Authorization header.
+func requireBearerToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get(authorizationHeader)
+		provided, ok := strings.CutPrefix(header, bearerPrefix)
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kwb"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,184 @@
+package kwb
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// Vectors of all documents of a file are stored together in bleve internal storage,
+// so they are written and removed in the same batch as the documents themselves.
+const vectorKeyPrefix = "kwb_vectors:"
+
+func vectorKey(path string) []byte {
+	return []byte(vectorKeyPrefix + path)
+}
+
+// embeddingText returns text of a document which is embedded, empty if document has no content.
+func embeddingText(doc document) string {
+	if doc.Content == "" {
+		return ""
+	}
+	return doc.Path + "\n" + doc.Content
+}
+
+// embedDocuments returns encoded vectors of documents with content, nil if there are none.
+func embedDocuments(ctx context.Context, embedder Embedder, docs []document) ([]byte, error) {
+	ids := make([]string, 0, len(docs))
+	texts := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		if text := embeddingText(doc); text != "" {
+			ids = append(ids, doc.ID)
+			texts = append(texts, text)
+		}
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	vectors, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(ids) {
+		return nil, fmt.Errorf("expected %d vectors, got %d", len(ids), len(vectors))
+	}
+	return encodeVectors(ids, vectors), nil
+}
+
+// encodeVectors encodes document ids and their vectors as
+// repeated (id length, id, dimensions, float32 values), little endian.
+func encodeVectors(ids []string, vectors [][]float32) []byte {
+	var buf []byte
+	for i, id := range ids {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(id)))
+		buf = append(buf, id...)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(vectors[i])))
+		for _, v := range vectors[i] {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+		}
+	}
+	return buf
+}
+
+func decodeVectors(data []byte, fn func(id string, vector []float32)) error {
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return fmt.Errorf("truncated vector data")
+		}
+		n := int(binary.LittleEndian.Uint32(data))
+		data = data[4:]
+		if len(data) < n+4 {
+			return fmt.Errorf("truncated vector data")
+		}
+		id := string(data[:n])
+		data = data[n:]
+
+		dims := int(binary.LittleEndian.Uint32(data))
+		data = data[4:]
+		if len(data) < dims*4 {
+			return fmt.Errorf("truncated vector data")
+		}
+		vector := make([]float32, dims)
+		for i := range vector {
+			vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+		}
+		data = data[dims*4:]
+
+		fn(id, vector)
+	}
+	return nil
+}
+
+// vectorSet holds vectors of all documents of an index generation in memory.
+type vectorSet struct {
+	index    bleve.Index
+	embedder string
+	ids      []string
+	vectors  [][]float32
+
+	// Ids of documents of dependency modules, ranked below project documents
+	dependencies map[string]bool
+}
+
+// loadVectors reads vectors of every indexed file.
+func loadVectors(index bleve.Index) (*vectorSet, error) {
+	mf, err := loadManifest(index)
+	if err != nil {
+		return nil, err
+	}
+	set := &vectorSet{index: index, dependencies: make(map[string]bool)}
+	if mf == nil {
+		return set, nil
+	}
+	set.embedder = mf.Embedder
+
+	for path := range mf.Files {
+		data, err := index.GetInternal(vectorKey(path))
+		if err != nil {
+			return nil, fmt.Errorf("reading vectors of %s: %w", path, err)
+		}
+		dependency := mf.fileType(path) == typeDependency
+		err = decodeVectors(data, func(id string, vector []float32) {
+			set.ids = append(set.ids, id)
+			set.vectors = append(set.vectors, vector)
+			if dependency {
+				set.dependencies[id] = true
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("decoding vectors of %s: %w", path, err)
+		}
+	}
+	return set, nil
+}
+
+type scoredID struct {
+	id    string
+	score float64
+}
+
+// rank returns documents similar to query vector, best first.
+// If allowed is not nil, only documents in it are considered.
+// Documents which are not similar at all are never returned.
+func (vs *vectorSet) rank(query []float32, allowed map[string]bool) []scoredID {
+	scored := make([]scoredID, 0, len(vs.ids))
+	for i, id := range vs.ids {
+		if allowed != nil && !allowed[id] {
+			continue
+		}
+		score := dot(query, vs.vectors[i])
+		if score <= 0 {
+			continue
+		}
+		scored = append(scored, scoredID{id: id, score: score})
+	}
+	sortScored(scored)
+	return scored
+}
+
+// projectFirst moves documents of dependencies below project documents,
+// keeping order within each group.
+func (vs *vectorSet) projectFirst(docs []scoredID) {
+	if len(vs.dependencies) == 0 {
+		return
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		return !vs.dependencies[docs[i].id] && vs.dependencies[docs[j].id]
+	})
+}
+
+func dot(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
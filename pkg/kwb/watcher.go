@@ -0,0 +1,155 @@
+package kwb
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const defaultWatchDebounce = 500 * time.Millisecond
+
+// watcher keeps index up to date with file system changes.
+type watcher struct {
+	logger       *slog.Logger
+	settings     *Settings
+	indexManager *indexManager
+}
+
+func newWatcher(settings *Settings, indexManager *indexManager, logger *slog.Logger) *watcher {
+	return &watcher{
+		logger:       logger,
+		settings:     settings,
+		indexManager: indexManager,
+	}
+}
+
+// Run watches roots until ctx is cancelled.
+// Changes are collected and applied to the index after a quiet period.
+func (w *watcher) Run(ctx context.Context, roots []Root) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating watcher: %w", err)
+	}
+	defer fsw.Close() // nolint:errcheck
+
+	for _, root := range roots {
+		if err := w.addTree(fsw, root.Path, root.Path, nil); err != nil {
+			return fmt.Errorf("watching %s: %w", root.Path, err)
+		}
+		if !w.settings.NoGitignore {
+			// Git directory is excluded, but its exclude file holds ignore patterns.
+			// Repository may have no such directory.
+			_ = fsw.Add(filepath.Join(root.Path, filepath.Dir(gitExcludeFile)))
+		}
+	}
+
+	debounce := w.settings.WatchDebounce
+	if debounce <= 0 {
+		debounce = defaultWatchDebounce
+	}
+
+	pending := make(map[string]struct{})
+	resync := false
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+
+	w.logger.Info("watching for changes", slog.Any("roots", roots))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			w.logger.Error("watcher error", slog.String("error", err.Error()))
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			path := filepath.Clean(event.Name)
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			root, ok := rootOf(roots, path)
+			if !ok {
+				continue
+			}
+			if dir, ok := ignoreFileDir(root.Path, path); ok {
+				// Changed ignore rules may affect any file below, not only changed ones
+				w.indexManager.ignoreRules(root.Path).Invalidate(dir)
+				resync = true
+			}
+			if w.isGitInfo(root.Path, path) {
+				// Only exclude file is watched there, nothing to index
+				timer.Reset(debounce)
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				// New directories are not watched automatically,
+				// files created in them before the watch was added are queued too.
+				if err := w.addTree(fsw, root.Path, path, pending); err != nil {
+					w.logger.Warn("failed to watch directory",
+						slog.String("path", path),
+						slog.String("error", err.Error()))
+				}
+			}
+			pending[path] = struct{}{}
+			timer.Reset(debounce)
+		case <-timer.C:
+			if resync {
+				clear(pending)
+				resync = false
+				if _, err := w.indexManager.SyncIndex(roots); err != nil {
+					w.logger.Error("failed to synchronize index", slog.String("error", err.Error()))
+				}
+				continue
+			}
+			paths := make([]string, 0, len(pending))
+			for path := range pending {
+				paths = append(paths, path)
+			}
+			clear(pending)
+			if err := w.indexManager.UpdateFiles(roots, paths); err != nil {
+				w.logger.Error("failed to update index", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// addTree adds watches for path and its non-excluded subdirectories.
+// If pending is not nil, files found along the way are added to it.
+func (w *watcher) addTree(fsw *fsnotify.Watcher, rootPath, path string, pending map[string]struct{}) error {
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Path could have been removed already
+			return nil
+		}
+		if !d.IsDir() {
+			if pending != nil {
+				pending[p] = struct{}{}
+			}
+			return nil
+		}
+		if p != path || pending != nil {
+			if w.indexManager.isExcludedDir(rootPath, p) {
+				return filepath.SkipDir
+			}
+		}
+		if err := fsw.Add(p); err != nil {
+			return fmt.Errorf("adding watch for %s: %w", p, err)
+		}
+		return nil
+	})
+}
+
+// isGitInfo reports whether path is in git info directory of root.
+func (w *watcher) isGitInfo(rootPath, path string) bool {
+	return filepath.Dir(path) == filepath.Join(rootPath, filepath.Dir(gitExcludeFile))
+}
@@ -0,0 +1,124 @@
+package kwb
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startWatcher builds index of root and watches it until the test ends.
+// Returns channel receiving every index change made by the watcher.
+func startWatcher(t *testing.T, root string) <-chan IndexChange {
+	t.Helper()
+	settings := &Settings{
+		IndexPath:     filepath.Join(t.TempDir(), "kb.index"),
+		MaxFileSize:   1024 * 1024,
+		BatchSize:     100,
+		IndexType:     "scorch",
+		WatchDebounce: 200 * time.Millisecond,
+	}
+	logger := slog.New(slog.DiscardHandler)
+	m := newIndexManager(settings, "test", nil, logger)
+	roots := []Root{{Path: root}}
+	if err := m.BuildIndex(roots); err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+	t.Cleanup(func() { _ = m.CloseIndex() })
+
+	changes := make(chan IndexChange, 10)
+	m.onChange(func(change IndexChange) {
+		changes <- change
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- newWatcher(settings, m, logger).Run(ctx, roots)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	})
+
+	// Watches are added before Run starts waiting for events
+	time.Sleep(100 * time.Millisecond)
+	return changes
+}
+
+func waitChange(t *testing.T, changes <-chan IndexChange) IndexChange {
+	t.Helper()
+	select {
+	case change := <-changes:
+		return change
+	case <-time.After(5 * time.Second):
+		t.Fatal("no index change")
+		return IndexChange{}
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcher_CoalescesChanges(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "main.go"), "package main\n")
+	changes := startWatcher(t, root)
+
+	// Every write comes within debounce of the previous one
+	for i := 0; i < 5; i++ {
+		writeTestFile(t, filepath.Join(root, "main.go"), "package main\n\n"+strings.Repeat("// edit\n", i+1))
+		writeTestFile(t, filepath.Join(root, "new.go"), "package main\n")
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	change := waitChange(t, changes)
+	if !slices.Equal(change.Added, []string{"new.go"}) || !slices.Equal(change.Updated, []string{"main.go"}) {
+		t.Errorf("change = %+v, want new.go added and main.go updated", change)
+	}
+	select {
+	case change := <-changes:
+		t.Errorf("changes were not coalesced, got another change %+v", change)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestWatcher_Deletes(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "main.go"), "package main\n")
+	writeTestFile(t, filepath.Join(root, "old.go"), "package main\n")
+	writeTestFile(t, filepath.Join(root, "sub", "a.go"), "package sub\n")
+	writeTestFile(t, filepath.Join(root, "sub", "deep", "b.go"), "package deep\n")
+	changes := startWatcher(t, root)
+
+	if err := os.Remove(filepath.Join(root, "old.go")); err != nil {
+		t.Fatal(err)
+	}
+	change := waitChange(t, changes)
+	if !slices.Equal(change.Removed, []string{"old.go"}) {
+		t.Errorf("change = %+v, want old.go removed", change)
+	}
+
+	// Removed directory drops every file beneath it
+	if err := os.RemoveAll(filepath.Join(root, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	change = waitChange(t, changes)
+	slices.Sort(change.Removed)
+	if !slices.Equal(change.Removed, []string{"sub/a.go", "sub/deep/b.go"}) {
+		t.Errorf("change = %+v, want files of sub removed", change)
+	}
+}